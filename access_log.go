@@ -0,0 +1,156 @@
+package http_json_api
+
+import (
+	"io"
+	gohttp "net/http"
+	"sort"
+	"time"
+
+	"github.com/gogap/spirit"
+	"github.com/rs/xid"
+)
+
+// AccessLogConfig logs an entry of each request after the response written,
+// the internal multi call layers are logged with the correlation id of the
+// original request
+type AccessLogConfig struct {
+	Enabled           bool `json:"enabled"`
+	TrustForwardedFor bool `json:"trust_forwarded_for"`
+}
+
+type accessLog struct {
+	startAt       time.Time
+	correlationId string
+
+	apiIds    map[string]string
+	callApis  map[string]string
+	responses map[string]APIResponse
+	err       error
+
+	reader *accessLogReader
+	writer *accessLogWriter
+}
+
+// beginAccessLog reads the correlation id from request header or generates
+// one, the id is echoed in response headers and forwarded to the internal
+// multi call layers by the request header
+func (p *JsonApiReceiver) beginAccessLog(res gohttp.ResponseWriter, req *gohttp.Request, startAt time.Time) (access *accessLog, w gohttp.ResponseWriter) {
+	header := p.conf.HeaderDefines.CorrelationIdHeader
+
+	correlationId := req.Header.Get(header)
+	if correlationId == "" {
+		correlationId = xid.New().String()
+		req.Header.Set(header, correlationId)
+	}
+
+	res.Header().Set(header, correlationId)
+
+	access = &accessLog{
+		startAt:       startAt,
+		correlationId: correlationId,
+		writer:        &accessLogWriter{ResponseWriter: res},
+	}
+
+	if req.Body != nil {
+		access.reader = &accessLogReader{ReadCloser: req.Body}
+		req.Body = access.reader
+	}
+
+	w = access.writer
+
+	return
+}
+
+func (p *JsonApiReceiver) writeAccessLog(access *accessLog, req *gohttp.Request) {
+	if !p.conf.AccessLog.Enabled {
+		return
+	}
+
+	entry := spirit.Logger().
+		WithField("event", "access").
+		WithField("urn", p.URN()).
+		WithField("name", p.Name())
+
+	for key, value := range p.accessLogFields(access, req) {
+		entry = entry.WithField(key, value)
+	}
+
+	entry.Infoln("access")
+}
+
+// accessLogFields returns the fields of the access log line
+func (p *JsonApiReceiver) accessLogFields(access *accessLog, req *gohttp.Request) (fields map[string]interface{}) {
+	statusCode := access.writer.statusCode
+	if statusCode == 0 {
+		statusCode = gohttp.StatusOK
+	}
+
+	var bytesIn int64
+	if access.reader != nil {
+		bytesIn = access.reader.count
+	}
+
+	apis := []string{}
+	for _, api := range access.callApis {
+		apis = append(apis, api)
+	}
+	sort.Strings(apis)
+
+	codes := map[string]uint64{}
+	for callName, resp := range access.responses {
+		codes[callName] = resp.Code
+	}
+
+	if access.err != nil {
+		codes[""] = p.errorToApiResponse(access.err).Code
+	}
+
+	fields = map[string]interface{}{
+		"correlation_id":   access.correlationId,
+		"method":           req.Method,
+		"path":             req.URL.Path,
+		"multi_call_layer": p.isMultiCallLayer(req),
+		"apis":             apis,
+		"deliveries":       access.apiIds,
+		"codes":            codes,
+		"status":           statusCode,
+		"latency":          time.Since(access.startAt).Seconds(),
+		"client_ip":        clientIp(req, p.conf.AccessLog.TrustForwardedFor),
+		"bytes_in":         bytesIn,
+		"bytes_out":        access.writer.count,
+	}
+
+	return
+}
+
+type accessLogReader struct {
+	io.ReadCloser
+
+	count int64
+}
+
+func (p *accessLogReader) Read(data []byte) (n int, err error) {
+	n, err = p.ReadCloser.Read(data)
+	p.count += int64(n)
+	return
+}
+
+type accessLogWriter struct {
+	gohttp.ResponseWriter
+
+	statusCode int
+	count      int64
+}
+
+func (p *accessLogWriter) WriteHeader(statusCode int) {
+	if p.statusCode == 0 {
+		p.statusCode = statusCode
+	}
+	p.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (p *accessLogWriter) Write(data []byte) (n int, err error) {
+	n, err = p.ResponseWriter.Write(data)
+	p.count += int64(n)
+	return
+}
@@ -0,0 +1,90 @@
+package http_json_api
+
+import (
+	"io/ioutil"
+	gohttp "net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBeginAccessLogCorrelationId(t *testing.T) {
+	conf := JsonApiReceiverConfig{}
+	conf.initial()
+
+	receiver := &JsonApiReceiver{name: "test", conf: conf}
+
+	cases := []struct {
+		name          string
+		correlationId string
+	}{
+		{"read from header", "c1"},
+		{"generated", ""},
+	}
+
+	for _, c := range cases {
+		req, _ := gohttp.NewRequest("POST", "/order.get", nil)
+		if c.correlationId != "" {
+			req.Header.Set(DefaultCorrelationIdHeader, c.correlationId)
+		}
+
+		recorder := httptest.NewRecorder()
+		access, _ := receiver.beginAccessLog(recorder, req, time.Now())
+
+		if access.correlationId == "" || c.correlationId != "" && access.correlationId != c.correlationId {
+			t.Errorf("%s: unexpected correlation id %q", c.name, access.correlationId)
+		}
+
+		// the id is forwarded to the internal layers and echoed to client
+		if id := req.Header.Get(DefaultCorrelationIdHeader); id != access.correlationId {
+			t.Errorf("%s: expect the request header %q, got %q", c.name, access.correlationId, id)
+		}
+
+		if id := recorder.Header().Get(DefaultCorrelationIdHeader); id != access.correlationId {
+			t.Errorf("%s: expect the response header %q, got %q", c.name, access.correlationId, id)
+		}
+	}
+}
+
+func TestAccessLogFields(t *testing.T) {
+	conf := JsonApiReceiverConfig{}
+	conf.initial()
+
+	receiver := &JsonApiReceiver{name: "test", conf: conf}
+
+	req, _ := gohttp.NewRequest("POST", "/order.get", strings.NewReader(`{"id":1}`))
+	req.Header.Set(DefaultCorrelationIdHeader, "c1")
+	req.RemoteAddr = "10.0.0.1:1000"
+
+	access, w := receiver.beginAccessLog(httptest.NewRecorder(), req, time.Now())
+
+	ioutil.ReadAll(req.Body)
+
+	w.WriteHeader(gohttp.StatusNotFound)
+	w.Write([]byte(`{"code":1001}`))
+
+	access.apiIds = map[string]string{"d1": "order", "d2": "user"}
+	access.callApis = map[string]string{"order": "order.get", "user": "user.get"}
+	access.responses = map[string]APIResponse{"order": {Code: 1001}, "user": {}}
+
+	fields := receiver.accessLogFields(access, req)
+
+	expect := map[string]interface{}{
+		"correlation_id": "c1",
+		"apis":           []string{"order.get", "user.get"},
+		"deliveries":     map[string]string{"d1": "order", "d2": "user"},
+		"codes":          map[string]uint64{"order": 1001, "user": 0},
+		"status":         gohttp.StatusNotFound,
+		"client_ip":      "10.0.0.1",
+		"bytes_in":       int64(8),
+		"bytes_out":      int64(13),
+	}
+
+	for key, value := range expect {
+		if !reflect.DeepEqual(fields[key], value) {
+			t.Errorf("expect %s %v, got %v", key, value, fields[key])
+		}
+	}
+}
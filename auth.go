@@ -0,0 +1,165 @@
+package http_json_api
+
+import (
+	gohttp "net/http"
+	"sort"
+
+	"github.com/gogap/errors"
+	"github.com/gogap/spirit"
+)
+
+// AuthPrincipal is the verified identity of request, it is set into the
+// payload context by key CTX_HTTP_AUTH
+type AuthPrincipal struct {
+	Verifier  string                 `json:"verifier"`
+	Type      string                 `json:"type"`
+	Principal string                 `json:"principal"`
+	Claims    map[string]interface{} `json:"claims,omitempty"`
+}
+
+// AuthVerifier verifies the credential of request, it should return nil
+// principal without error if the request has no credential for it, the body
+// is empty for the GET and form requests
+type AuthVerifier interface {
+	Verify(req *gohttp.Request, body []byte) (principal *AuthPrincipal, err error)
+}
+
+type NewAuthVerifierFunc func(name string, options spirit.Map) (verifier AuthVerifier, err error)
+
+var authVerifierTypes = map[string]NewAuthVerifierFunc{
+	AuthTypeApiKey: newApiKeyVerifier,
+	AuthTypeBasic:  newBasicVerifier,
+	AuthTypeHmac:   newHmacVerifier,
+	AuthTypeJwt:    newJwtVerifier,
+}
+
+// RegisterAuthVerifier registers the verifier type could be used in auth config
+func RegisterAuthVerifier(typ string, fn NewAuthVerifierFunc) {
+	authVerifierTypes[typ] = fn
+}
+
+type AuthVerifierConfig struct {
+	Type    string     `json:"type"`
+	Options spirit.Map `json:"options"`
+}
+
+// AuthConfig is the verifiers by name and the verifier names of apis, any of
+// the verifiers of api passed is enough, the api without verifiers is public
+type AuthConfig struct {
+	Default   []string                      `json:"default"`
+	Apis      map[string][]string           `json:"apis"`
+	Verifiers map[string]AuthVerifierConfig `json:"verifiers"`
+}
+
+func (p *AuthConfig) VerifiersOf(apiName string) []string {
+	if names, exist := p.Apis[apiName]; exist {
+		return names
+	}
+	return p.Default
+}
+
+func newAuthVerifiers(conf AuthConfig) (verifiers map[string]AuthVerifier, err error) {
+	verifiers = make(map[string]AuthVerifier)
+
+	for name, verifierConf := range conf.Verifiers {
+		fn, exist := authVerifierTypes[verifierConf.Type]
+		if !exist {
+			err = ErrLoadAuthVerifierFailed.New(errors.Params{"name": name, "err": "unknown type " + verifierConf.Type})
+			return
+		}
+
+		options := verifierConf.Options
+		if options == nil {
+			options = spirit.Map{}
+		}
+
+		var verifier AuthVerifier
+		if verifier, err = fn(name, options); err != nil {
+			err = ErrLoadAuthVerifierFailed.New(errors.Params{"name": name, "err": err})
+			return
+		}
+
+		verifiers[name] = verifier
+	}
+
+	apis := map[string][]string{"*": conf.Default}
+	for apiName, names := range conf.Apis {
+		apis[apiName] = names
+	}
+
+	for _, names := range apis {
+		for _, name := range names {
+			if _, exist := verifiers[name]; !exist {
+				err = ErrLoadAuthVerifierFailed.New(errors.Params{"name": name, "err": "verifier not exist"})
+				return
+			}
+		}
+	}
+
+	return
+}
+
+type authResult struct {
+	principal *AuthPrincipal
+	err       error
+}
+
+// authenticate returns the principals of apis, each verifier runs once for
+// the request, the principals of internal multi call layer requests are
+// verified before dispatching and carried by the request context
+func (p *JsonApiReceiver) authenticate(req *gohttp.Request, apiNames []string, body []byte) (principals map[string]*AuthPrincipal, err error) {
+	if verified, isLayer := multiCallLayerPrincipals(req); isLayer {
+		principals = verified
+		return
+	}
+
+	principals = make(map[string]*AuthPrincipal)
+
+	results := map[string]authResult{}
+
+	sort.Strings(apiNames)
+
+	for _, apiName := range apiNames {
+		names := p.conf.Auth.VerifiersOf(apiName)
+		if len(names) == 0 {
+			continue
+		}
+
+		var lastErr error
+
+		for _, name := range names {
+			result, exist := results[name]
+			if !exist {
+				result.principal, result.err = p.authVerifiers[name].Verify(req, body)
+				if result.principal != nil {
+					result.principal.Verifier = name
+				}
+				results[name] = result
+			}
+
+			if result.err != nil {
+				lastErr = result.err
+				continue
+			}
+
+			if result.principal != nil {
+				principals[apiName] = result.principal
+				break
+			}
+		}
+
+		if principals[apiName] != nil {
+			continue
+		}
+
+		if lastErr != nil {
+			err = ErrAuthFailed.New(errors.Params{"apiName": apiName, "reason": lastErr.Error()})
+		} else {
+			err = ErrAuthRequired.New(errors.Params{"apiName": apiName})
+		}
+
+		return
+	}
+
+	return
+}
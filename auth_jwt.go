@@ -0,0 +1,268 @@
+package http_json_api
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"math/big"
+	gohttp "net/http"
+	"strings"
+	"time"
+
+	"github.com/gogap/spirit"
+)
+
+// jwtVerifier verifies the bearer token signed by HS256/384/512 with the
+// secret or RS256/384/512 with the keys of local jwks file
+type jwtVerifier struct {
+	Secret         string `json:"secret"`
+	JwksFile       string `json:"jwks_file"`
+	Issuer         string `json:"issuer"`
+	Audience       string `json:"audience"`
+	Leeway         int    `json:"leeway"` // seconds
+	PrincipalClaim string `json:"principal_claim"`
+
+	rsaKeys map[string]*rsa.PublicKey
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+func newJwtVerifier(name string, options spirit.Map) (verifier AuthVerifier, err error) {
+	v := &jwtVerifier{}
+	if err = options.ToObject(v); err != nil {
+		return
+	}
+
+	if v.PrincipalClaim == "" {
+		v.PrincipalClaim = "sub"
+	}
+
+	if v.Secret == "" && v.JwksFile == "" {
+		err = fmt.Errorf("secret or jwks file is required")
+		return
+	}
+
+	if v.JwksFile != "" {
+		if v.rsaKeys, err = loadJwksFile(v.JwksFile); err != nil {
+			return
+		}
+	}
+
+	verifier = v
+
+	return
+}
+
+func loadJwksFile(filename string) (keys map[string]*rsa.PublicKey, err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(filename); err != nil {
+		return
+	}
+
+	set := jwks{}
+	if err = json.Unmarshal(data, &set); err != nil {
+		return
+	}
+
+	keys = make(map[string]*rsa.PublicKey)
+
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" {
+			continue
+		}
+
+		var n, e []byte
+		if n, err = base64.RawURLEncoding.DecodeString(key.N); err != nil {
+			return
+		}
+
+		if e, err = base64.RawURLEncoding.DecodeString(key.E); err != nil {
+			return
+		}
+
+		keys[key.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	return
+}
+
+func (p *jwtVerifier) Verify(req *gohttp.Request, body []byte) (principal *AuthPrincipal, err error) {
+	authorization := req.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return
+	}
+
+	token := strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		err = fmt.Errorf("malformed token")
+		return
+	}
+
+	header := jwtHeader{}
+	if err = decodeJwtSegment(parts[0], &header); err != nil {
+		return
+	}
+
+	var signature []byte
+	if signature, err = base64.RawURLEncoding.DecodeString(parts[2]); err != nil {
+		err = fmt.Errorf("malformed token signature")
+		return
+	}
+
+	if err = p.verifySignature(header, parts[0]+"."+parts[1], signature); err != nil {
+		return
+	}
+
+	claims := map[string]interface{}{}
+	if err = decodeJwtSegment(parts[1], &claims); err != nil {
+		return
+	}
+
+	if err = p.verifyClaims(claims); err != nil {
+		return
+	}
+
+	strPrincipal, _ := claims[p.PrincipalClaim].(string)
+
+	principal = &AuthPrincipal{
+		Type:      AuthTypeJwt,
+		Principal: strPrincipal,
+		Claims:    claims,
+	}
+
+	return
+}
+
+func (p *jwtVerifier) verifySignature(header jwtHeader, signingInput string, signature []byte) (err error) {
+	var hashFunc func() hash.Hash
+	var cryptoHash crypto.Hash
+
+	if len(header.Alg) != 5 {
+		return fmt.Errorf("unsupported alg %s", header.Alg)
+	}
+
+	switch header.Alg[2:] {
+	case "256":
+		hashFunc, cryptoHash = sha256.New, crypto.SHA256
+	case "384":
+		hashFunc, cryptoHash = sha512.New384, crypto.SHA384
+	case "512":
+		hashFunc, cryptoHash = sha512.New, crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported alg %s", header.Alg)
+	}
+
+	switch header.Alg[:2] {
+	case "HS":
+		if p.Secret == "" {
+			return fmt.Errorf("unsupported alg %s", header.Alg)
+		}
+
+		mac := hmac.New(hashFunc, []byte(p.Secret))
+		mac.Write([]byte(signingInput))
+
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return fmt.Errorf("signature mismatch")
+		}
+	case "RS":
+		key, exist := p.rsaKeys[header.Kid]
+		if !exist && header.Kid == "" && len(p.rsaKeys) == 1 {
+			for _, k := range p.rsaKeys {
+				key, exist = k, true
+			}
+		}
+
+		if !exist {
+			return fmt.Errorf("unknown key id %s", header.Kid)
+		}
+
+		h := hashFunc()
+		h.Write([]byte(signingInput))
+
+		if rsa.VerifyPKCS1v15(key, cryptoHash, h.Sum(nil), signature) != nil {
+			return fmt.Errorf("signature mismatch")
+		}
+	default:
+		return fmt.Errorf("unsupported alg %s", header.Alg)
+	}
+
+	return
+}
+
+func (p *jwtVerifier) verifyClaims(claims map[string]interface{}) (err error) {
+	now := time.Now().Unix()
+	leeway := int64(p.Leeway)
+
+	if exp, ok := claims["exp"].(float64); ok && now > int64(exp)+leeway {
+		return fmt.Errorf("token expired")
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now+leeway < int64(nbf) {
+		return fmt.Errorf("token not valid yet")
+	}
+
+	if p.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != p.Issuer {
+			return fmt.Errorf("bad issuer")
+		}
+	}
+
+	if p.Audience != "" {
+		matched := false
+
+		switch aud := claims["aud"].(type) {
+		case string:
+			matched = aud == p.Audience
+		case []interface{}:
+			for _, item := range aud {
+				if str, _ := item.(string); str == p.Audience {
+					matched = true
+					break
+				}
+			}
+		}
+
+		if !matched {
+			return fmt.Errorf("bad audience")
+		}
+	}
+
+	return
+}
+
+func decodeJwtSegment(segment string, v interface{}) (err error) {
+	var data []byte
+	if data, err = base64.RawURLEncoding.DecodeString(segment); err != nil {
+		return fmt.Errorf("malformed token")
+	}
+
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("malformed token")
+	}
+
+	return
+}
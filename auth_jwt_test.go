@@ -0,0 +1,149 @@
+package http_json_api
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	gohttp "net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gogap/spirit"
+)
+
+func newJwtToken(t *testing.T, header, claims map[string]interface{}, secret string, rsaKey *rsa.PrivateKey) string {
+	bHeader, _ := json.Marshal(header)
+	bClaims, _ := json.Marshal(claims)
+
+	signingInput := base64.RawURLEncoding.EncodeToString(bHeader) + "." + base64.RawURLEncoding.EncodeToString(bClaims)
+
+	var signature []byte
+
+	if rsaKey != nil {
+		sum := sha256.Sum256([]byte(signingInput))
+
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, sum[:]); err != nil {
+			t.Fatal(err)
+		}
+	} else if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJwksFile(t *testing.T, kid string, key *rsa.PublicKey) string {
+	data, _ := json.Marshal(map[string]interface{}{
+		"keys": []interface{}{
+			map[string]interface{}{
+				"kty": "RSA",
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			},
+		},
+	})
+
+	filename := filepath.Join(t.TempDir(), "jwks.json")
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return filename
+}
+
+func TestJwtVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherRsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hsVerifier, err := newJwtVerifier("jwt", spirit.Map{"secret": "secret1", "issuer": "iss1", "audience": "aud1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsVerifier, err := newJwtVerifier("jwt", spirit.Map{"jwks_file": writeJwksFile(t, "k1", &rsaKey.PublicKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Unix()
+
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"sub": "u1", "iss": "iss1", "aud": "aud1", "exp": now + 60}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	hs256 := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+
+	cases := []struct {
+		name      string
+		verifier  AuthVerifier
+		token     string
+		expectErr bool
+	}{
+		{"hs256", hsVerifier, newJwtToken(t, hs256, claims(nil), "secret1", nil), false},
+		{"hs256 audience in array", hsVerifier, newJwtToken(t, hs256, claims(map[string]interface{}{"aud": []string{"aud0", "aud1"}}), "secret1", nil), false},
+		{"hs256 bad signature", hsVerifier, newJwtToken(t, hs256, claims(nil), "secret2", nil), true},
+		{"alg none", hsVerifier, newJwtToken(t, map[string]interface{}{"alg": "none"}, claims(nil), "", nil), true},
+		{"expired", hsVerifier, newJwtToken(t, hs256, claims(map[string]interface{}{"exp": now - 60}), "secret1", nil), true},
+		{"not valid yet", hsVerifier, newJwtToken(t, hs256, claims(map[string]interface{}{"nbf": now + 60}), "secret1", nil), true},
+		{"issuer mismatch", hsVerifier, newJwtToken(t, hs256, claims(map[string]interface{}{"iss": "iss2"}), "secret1", nil), true},
+		{"audience mismatch", hsVerifier, newJwtToken(t, hs256, claims(map[string]interface{}{"aud": "aud2"}), "secret1", nil), true},
+		{"audience missing", hsVerifier, newJwtToken(t, hs256, claims(map[string]interface{}{"aud": nil}), "secret1", nil), true},
+		{"malformed", hsVerifier, "a.b", true},
+		{"rs256", rsVerifier, newJwtToken(t, map[string]interface{}{"alg": "RS256", "kid": "k1"}, claims(nil), "", rsaKey), false},
+		{"rs256 without kid of single key", rsVerifier, newJwtToken(t, map[string]interface{}{"alg": "RS256"}, claims(nil), "", rsaKey), false},
+		{"rs256 wrong kid", rsVerifier, newJwtToken(t, map[string]interface{}{"alg": "RS256", "kid": "k2"}, claims(nil), "", rsaKey), true},
+		{"rs256 bad signature", rsVerifier, newJwtToken(t, map[string]interface{}{"alg": "RS256", "kid": "k1"}, claims(nil), "", otherRsaKey), true},
+		{"hs256 without secret", rsVerifier, newJwtToken(t, hs256, claims(nil), "secret1", nil), true},
+	}
+
+	for _, c := range cases {
+		req, _ := gohttp.NewRequest("POST", "/order.get", nil)
+		req.Header.Set("Authorization", "Bearer "+c.token)
+
+		principal, err := c.verifier.Verify(req, nil)
+
+		if (err != nil) != c.expectErr {
+			t.Errorf("%s: expect error %v, got %v", c.name, c.expectErr, err)
+			continue
+		}
+
+		if err == nil && (principal == nil || principal.Principal != "u1" || principal.Type != AuthTypeJwt) {
+			t.Errorf("%s: expect principal u1, got %v", c.name, principal)
+		}
+	}
+
+	req, _ := gohttp.NewRequest("POST", "/order.get", nil)
+	if principal, err := hsVerifier.Verify(req, nil); principal != nil || err != nil {
+		t.Errorf("expect the request without bearer token skipped, got %v, %v", principal, err)
+	}
+
+	if _, err := newJwtVerifier("jwt", spirit.Map{}); err == nil {
+		t.Errorf("expect error without secret and jwks file")
+	}
+}
@@ -0,0 +1,197 @@
+package http_json_api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	gohttp "net/http"
+	"strconv"
+	"time"
+
+	"github.com/gogap/spirit"
+)
+
+const (
+	AuthTypeApiKey = "api_key"
+	AuthTypeBasic  = "basic"
+	AuthTypeHmac   = "hmac"
+	AuthTypeJwt    = "jwt"
+)
+
+var (
+	DefaultAuthApiKeyHeader    = "X-Api-Key"
+	DefaultAuthKeyIdHeader     = "X-Auth-Key-Id"
+	DefaultAuthTimestampHeader = "X-Auth-Timestamp"
+	DefaultAuthSignatureHeader = "X-Auth-Signature"
+)
+
+// apiKeyVerifier reads the key from header, the keys are mapped to principals
+type apiKeyVerifier struct {
+	Header string            `json:"header"`
+	Keys   map[string]string `json:"keys"`
+}
+
+func newApiKeyVerifier(name string, options spirit.Map) (verifier AuthVerifier, err error) {
+	v := &apiKeyVerifier{}
+	if err = options.ToObject(v); err != nil {
+		return
+	}
+
+	if v.Header == "" {
+		v.Header = DefaultAuthApiKeyHeader
+	}
+
+	verifier = v
+
+	return
+}
+
+func (p *apiKeyVerifier) Verify(req *gohttp.Request, body []byte) (principal *AuthPrincipal, err error) {
+	key := req.Header.Get(p.Header)
+	if key == "" {
+		return
+	}
+
+	for k, name := range p.Keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			principal = &AuthPrincipal{Type: AuthTypeApiKey, Principal: name}
+			return
+		}
+	}
+
+	err = fmt.Errorf("unknown api key")
+
+	return
+}
+
+// basicVerifier checks the user and password of basic auth
+type basicVerifier struct {
+	Users map[string]string `json:"users"`
+}
+
+func newBasicVerifier(name string, options spirit.Map) (verifier AuthVerifier, err error) {
+	v := &basicVerifier{}
+	if err = options.ToObject(v); err != nil {
+		return
+	}
+
+	verifier = v
+
+	return
+}
+
+func (p *basicVerifier) Verify(req *gohttp.Request, body []byte) (principal *AuthPrincipal, err error) {
+	user, password, ok := req.BasicAuth()
+	if !ok {
+		return
+	}
+
+	expected, exist := p.Users[user]
+	if !exist || subtle.ConstantTimeCompare([]byte(expected), []byte(password)) != 1 {
+		err = fmt.Errorf("bad user or password")
+		return
+	}
+
+	principal = &AuthPrincipal{Type: AuthTypeBasic, Principal: user}
+
+	return
+}
+
+// hmacVerifier checks the signature of method, request uri, timestamp and
+// body joined by new line, the keys are the secrets by key id, the form
+// requests are rejected
+type hmacVerifier struct {
+	KeyIdHeader     string            `json:"key_id_header"`
+	TimestampHeader string            `json:"timestamp_header"`
+	SignatureHeader string            `json:"signature_header"`
+	Keys            map[string]string `json:"keys"`
+	ReplayWindow    int               `json:"replay_window"` // seconds
+
+	replays *signatureReplays
+}
+
+func newHmacVerifier(name string, options spirit.Map) (verifier AuthVerifier, err error) {
+	v := &hmacVerifier{}
+	if err = options.ToObject(v); err != nil {
+		return
+	}
+
+	if v.KeyIdHeader == "" {
+		v.KeyIdHeader = DefaultAuthKeyIdHeader
+	}
+
+	if v.TimestampHeader == "" {
+		v.TimestampHeader = DefaultAuthTimestampHeader
+	}
+
+	if v.SignatureHeader == "" {
+		v.SignatureHeader = DefaultAuthSignatureHeader
+	}
+
+	if v.ReplayWindow <= 0 {
+		v.ReplayWindow = int(DefaultForwardedReplayWindow / time.Second)
+	}
+
+	v.replays = &signatureReplays{signatures: make(map[string]time.Time)}
+
+	verifier = v
+
+	return
+}
+
+func (p *hmacVerifier) Verify(req *gohttp.Request, body []byte) (principal *AuthPrincipal, err error) {
+	keyId := req.Header.Get(p.KeyIdHeader)
+	strTimestamp := req.Header.Get(p.TimestampHeader)
+	signature := req.Header.Get(p.SignatureHeader)
+
+	if signature == "" {
+		return
+	}
+
+	// the form body is parsed as stream without buffering, so it could not
+	// be signed
+	if isFormRequest(req) {
+		err = fmt.Errorf("hmac auth does not support form requests")
+		return
+	}
+
+	secret, exist := p.Keys[keyId]
+	if !exist {
+		err = fmt.Errorf("unknown key id %s", keyId)
+		return
+	}
+
+	timestamp, e := strconv.ParseInt(strTimestamp, 10, 64)
+	if e != nil {
+		err = fmt.Errorf("bad timestamp")
+		return
+	}
+
+	window := time.Duration(p.ReplayWindow) * time.Second
+	signedAt := time.Unix(timestamp, 0)
+
+	if diff := time.Now().Sub(signedAt); diff > window || diff < -window {
+		err = fmt.Errorf("timestamp out of replay window")
+		return
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(req.Method + "\n" + req.URL.RequestURI() + "\n" + strTimestamp + "\n"))
+	mac.Write(body)
+
+	if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(signature)) {
+		err = fmt.Errorf("signature mismatch")
+		return
+	}
+
+	if !p.replays.once(signature, signedAt.Add(window)) {
+		err = fmt.Errorf("replayed request")
+		return
+	}
+
+	principal = &AuthPrincipal{Type: AuthTypeHmac, Principal: keyId}
+
+	return
+}
@@ -0,0 +1,156 @@
+package http_json_api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	gohttp "net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogap/spirit"
+)
+
+func newHmacRequest(contentType, secret string, body []byte) *gohttp.Request {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, _ := gohttp.NewRequest("POST", "/api/order.create?v=1", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", contentType)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(req.Method + "\n" + req.URL.RequestURI() + "\n" + timestamp + "\n"))
+	mac.Write(body)
+
+	req.Header.Set(DefaultAuthKeyIdHeader, "k1")
+	req.Header.Set(DefaultAuthTimestampHeader, timestamp)
+	req.Header.Set(DefaultAuthSignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+
+	return req
+}
+
+func TestHmacVerifier(t *testing.T) {
+	verifier, err := newHmacVerifier("hmac", spirit.Map{"keys": map[string]interface{}{"k1": "secret1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsonBody := []byte(`{"sku":"a"}`)
+	replayed := newHmacRequest("application/json", "secret1", jsonBody)
+
+	cases := []struct {
+		name      string
+		req       *gohttp.Request
+		body      []byte
+		expectErr bool
+	}{
+		{"json body", replayed, jsonBody, false},
+		{"replayed", replayed, jsonBody, true},
+		{"wrong secret", newHmacRequest("application/json", "secret2", jsonBody), jsonBody, true},
+		{"body changed", newHmacRequest("application/json", "secret1", jsonBody), []byte(`{"sku":"b"}`), true},
+		{"urlencoded form", newHmacRequest("application/x-www-form-urlencoded", "secret1", nil), nil, true},
+		{"multipart form", newHmacRequest("multipart/form-data; boundary=x", "secret1", nil), nil, true},
+	}
+
+	for _, c := range cases {
+		principal, err := verifier.Verify(c.req, c.body)
+
+		if (err != nil) != c.expectErr {
+			t.Errorf("%s: expect error %v, got %v", c.name, c.expectErr, err)
+		}
+
+		if err == nil && (principal == nil || principal.Principal != "k1") {
+			t.Errorf("%s: expect principal k1, got %v", c.name, principal)
+		}
+	}
+
+	req, _ := gohttp.NewRequest("POST", "/api", nil)
+	if principal, err := verifier.Verify(req, nil); principal != nil || err != nil {
+		t.Errorf("expect the unsigned request skipped, got %v, %v", principal, err)
+	}
+}
+
+func TestApiKeyVerifier(t *testing.T) {
+	verifier, err := newApiKeyVerifier("api_key", spirit.Map{"keys": map[string]interface{}{"key1": "app1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name            string
+		key             string
+		expectPrincipal string
+		expectErr       bool
+	}{
+		{"good key", "key1", "app1", false},
+		{"bad key", "key2", "", true},
+		{"no key", "", "", false},
+	}
+
+	for _, c := range cases {
+		req, _ := gohttp.NewRequest("POST", "/api", nil)
+		if c.key != "" {
+			req.Header.Set(DefaultAuthApiKeyHeader, c.key)
+		}
+
+		principal, err := verifier.Verify(req, nil)
+
+		if (err != nil) != c.expectErr {
+			t.Errorf("%s: expect error %v, got %v", c.name, c.expectErr, err)
+			continue
+		}
+
+		strPrincipal := ""
+		if principal != nil {
+			strPrincipal = principal.Principal
+		}
+
+		if strPrincipal != c.expectPrincipal {
+			t.Errorf("%s: expect principal %q, got %v", c.name, c.expectPrincipal, principal)
+		}
+	}
+}
+
+func TestBasicVerifier(t *testing.T) {
+	verifier, err := newBasicVerifier("basic", spirit.Map{"users": map[string]interface{}{"user1": "password1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name            string
+		user            string
+		password        string
+		expectPrincipal string
+		expectErr       bool
+	}{
+		{"good password", "user1", "password1", "user1", false},
+		{"bad password", "user1", "password2", "", true},
+		{"unknown user", "user2", "password1", "", true},
+		{"no basic auth", "", "", "", false},
+	}
+
+	for _, c := range cases {
+		req, _ := gohttp.NewRequest("POST", "/api", nil)
+		if c.user != "" {
+			req.SetBasicAuth(c.user, c.password)
+		}
+
+		principal, err := verifier.Verify(req, nil)
+
+		if (err != nil) != c.expectErr {
+			t.Errorf("%s: expect error %v, got %v", c.name, c.expectErr, err)
+			continue
+		}
+
+		strPrincipal := ""
+		if principal != nil {
+			strPrincipal = principal.Principal
+		}
+
+		if strPrincipal != c.expectPrincipal {
+			t.Errorf("%s: expect principal %q, got %v", c.name, c.expectPrincipal, principal)
+		}
+	}
+}
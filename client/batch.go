@@ -0,0 +1,240 @@
+package api_client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gogap/errors"
+	"github.com/gogap/spirit"
+)
+
+// forwardedCall is the entry of forwarded multi call request, the call name
+// is the key of entry, so one api could be called several times in a batch
+type forwardedCall struct {
+	Api  string      `json:"$api"`
+	Data JsonPayload `json:"$data"`
+}
+
+type batchCall struct {
+	name        string
+	api         string
+	jsonPayload JsonPayload
+	payload     spirit.Payload
+	v           interface{}
+	err         error
+}
+
+// Batch collects the calls and sends them as one multi call request
+type Batch struct {
+	send  func(ctx context.Context, calls []*batchCall) error
+	calls []*batchCall
+	names map[string]bool
+}
+
+func newBatch(send func(ctx context.Context, calls []*batchCall) error) *Batch {
+	return &Batch{
+		send:  send,
+		names: make(map[string]bool),
+	}
+}
+
+// Add queues the call of api, the result of call is decoded into v, the call
+// name is the api name if it is empty
+func (p *Batch) Add(callName string, apiName string, payload spirit.Payload, v interface{}) (err error) {
+	apiName = strings.TrimSpace(apiName)
+	callName = strings.TrimSpace(callName)
+
+	if apiName == "" {
+		err = ErrAPINameIsEmpty.New()
+		return
+	}
+
+	if callName == "" {
+		callName = apiName
+	}
+
+	if p.names[callName] {
+		err = ErrAPIClientBatchCallDuplicated.New(errors.Params{"call": callName})
+		return
+	}
+
+	var jsonPayload JsonPayload
+	if jsonPayload, err = toJsonPayload(payload); err != nil {
+		return
+	}
+
+	p.names[callName] = true
+	p.calls = append(p.calls, &batchCall{
+		name:        callName,
+		api:         apiName,
+		jsonPayload: jsonPayload,
+		payload:     payload,
+		v:           v,
+	})
+
+	return
+}
+
+func (p *Batch) Len() int {
+	return len(p.calls)
+}
+
+// Send sends the queued calls, errs has the errors of the failed calls by
+// call name, err is the failure of the whole request
+func (p *Batch) Send(ctx context.Context) (errs map[string]error, err error) {
+	if len(p.calls) == 0 {
+		return
+	}
+
+	if err = p.send(ctx, p.calls); err != nil {
+		return
+	}
+
+	for _, call := range p.calls {
+		if call.err != nil {
+			if errs == nil {
+				errs = make(map[string]error)
+			}
+			errs[call.name] = call.err
+		}
+	}
+
+	return
+}
+
+func (p *HTTPAPIClient) NewBatch() *Batch {
+	return newBatch(p.sendBatch)
+}
+
+// sendBatch skips the calls of open circuits, and retries the whole request
+// like call
+func (p *HTTPAPIClient) sendBatch(ctx context.Context, calls []*batchCall) (err error) {
+	sending := []*batchCall{}
+
+	for _, call := range calls {
+		if !p.breakers.get(call.api).allow() {
+			call.err = ErrAPIClientCircuitOpen.New(errors.Params{"api": call.api})
+			continue
+		}
+		sending = append(sending, call)
+	}
+
+	if len(sending) == 0 {
+		return
+	}
+
+	defer func() {
+		for _, call := range sending {
+			if err != nil {
+				p.breakers.get(call.api).record(err)
+			} else {
+				p.breakers.get(call.api).record(call.err)
+			}
+		}
+	}()
+
+	for attempts := 1; ; attempts++ {
+		if err = p.sendBatchOnce(ctx, sending); err == nil {
+			return
+		}
+
+		if attempts > p.retry.MaxRetries || !p.retry.isRetryable(err) {
+			return
+		}
+
+		select {
+		case <-time.After(p.retry.backoff(attempts)):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *HTTPAPIClient) sendBatchOnce(ctx context.Context, calls []*batchCall) (err error) {
+	ep := p.endpoints.pick()
+
+	p.endpoints.acquire(ep)
+	defer func() {
+		p.endpoints.release(ep, err)
+	}()
+
+	names := []string{}
+	forwardedCalls := map[string]forwardedCall{}
+
+	for _, call := range calls {
+		names = append(names, call.name)
+		forwardedCalls[call.name] = forwardedCall{Api: call.api, Data: call.jsonPayload}
+	}
+
+	strNames := strings.Join(names, ",")
+
+	var data []byte
+	if data, err = json.Marshal(forwardedCalls); err != nil {
+		return
+	}
+
+	header := http.Header{}
+	header.Set(p.multiCallHeaderName, "on")
+
+	// the calls of batch share the trace context of ctx
+	injectTraceContext(ctx, header, nil)
+
+	p.sign.sign(header, "", data)
+
+	var body []byte
+	if body, err = p.post(ctx, ep.url, strNames, header, true, data); err != nil {
+		return
+	}
+
+	var batchResp struct {
+		Result map[string]struct {
+			Code           uint64       `json:"code"`
+			ErrorId        string       `json:"error_id,omitempty"`
+			ErrorNamespace string       `json:"error_namespace,omitempty"`
+			Message        string       `json:"message"`
+			Result         *JsonPayload `json:"result"`
+		} `json:"result"`
+	}
+
+	if e := json.Unmarshal(body, &batchResp); e != nil {
+		err = ErrAPIClientResponseUnmarshalFailed.New(errors.Params{"api": strNames, "url": ep.url}).Append(e)
+		return
+	}
+
+	for _, call := range calls {
+		call.err = nil
+
+		resp, exist := batchResp.Result[call.name]
+		if !exist {
+			call.err = ErrAPIClientBatchResponseMissing.New(errors.Params{"call": call.name})
+			continue
+		}
+
+		if p.forwardedResponse && resp.Result != nil {
+			if e := applyJsonPayload(call.payload, *resp.Result); e != nil {
+				call.err = e
+				continue
+			}
+		}
+
+		if resp.Code != 0 {
+			call.err = errors.NewErrorCode(resp.ErrorId, resp.Code, resp.ErrorNamespace, resp.Message, "", nil)
+			continue
+		}
+
+		if call.v == nil || resp.Result == nil {
+			continue
+		}
+
+		if data, e := json.Marshal(resp.Result.Data); e != nil {
+			call.err = e
+		} else if e = json.Unmarshal(data, call.v); e != nil {
+			call.err = ErrAPIClientResponseUnmarshalFailed.New(errors.Params{"api": call.api, "url": ep.url}).Append(e)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,136 @@
+package api_client
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBatchAdd(t *testing.T) {
+	batch := newBatch(nil)
+
+	cases := []struct {
+		name      string
+		callName  string
+		apiName   string
+		expectErr bool
+	}{
+		{"named call", "first", "order.get", false},
+		{"call name defaults to api name", "", "order.get", false},
+		{"same api with other name", "second", "order.get", false},
+		{"duplicated call name", "first", "user.get", true},
+		{"duplicated default call name", "", "order.get", true},
+		{"empty api name", "third", " ", true},
+	}
+
+	for _, c := range cases {
+		err := batch.Add(c.callName, c.apiName, newTestPayload(nil), nil)
+		if (err != nil) != c.expectErr {
+			t.Errorf("%s: expect error %v, got %v", c.name, c.expectErr, err)
+		}
+	}
+
+	if batch.Len() != 3 {
+		t.Errorf("expect 3 calls queued, got %d", batch.Len())
+	}
+
+	if errs, err := newBatch(nil).Send(context.Background()); errs != nil || err != nil {
+		t.Errorf("expect the empty batch not sent, got %v %v", errs, err)
+	}
+}
+
+func TestBatchSend(t *testing.T) {
+	cases := []struct {
+		name       string
+		statusCode int
+		body       string
+		expectErr  bool
+		expectErrs map[string]bool
+	}{
+		{
+			name:       "per call errors and missing call",
+			statusCode: http.StatusMultiStatus,
+			body: `{"code":0,"message":"","result":{
+				"order":{"code":0,"message":"","result":{"id":"p1","data":{"id":1}}},
+				"user":{"code":1001,"error_namespace":"USER","message":"not found","result":null}
+			}}`,
+			expectErrs: map[string]bool{"user": true, "stock": true},
+		},
+		{
+			name:       "all succeeded",
+			statusCode: http.StatusOK,
+			body: `{"code":0,"message":"","result":{
+				"order":{"code":0,"message":"","result":{"id":"p1","data":{"id":1}}},
+				"user":{"code":0,"message":"","result":{"id":"p2","data":{"id":2}}},
+				"stock":{"code":0,"message":"","result":{"id":"p3","data":null}}
+			}}`,
+		},
+		{
+			name:       "non-200 without result",
+			statusCode: http.StatusBadGateway,
+			body:       `bad gateway`,
+			expectErr:  true,
+		},
+	}
+
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Api-Multi-Call") == "" || r.Header.Get(HeaderForwardedPayload) == "" {
+				t.Errorf("%s: expect forwarded multi call request", c.name)
+			}
+
+			data, _ := ioutil.ReadAll(r.Body)
+
+			calls := map[string]forwardedCall{}
+			if err := json.Unmarshal(data, &calls); err != nil || calls["order"].Api != "order.get" || calls["stock"].Api != "stock.get" {
+				t.Errorf("%s: unexpected calls %s", c.name, data)
+			}
+
+			w.WriteHeader(c.statusCode)
+			w.Write([]byte(c.body))
+		}))
+
+		client := NewHTTPAPIClientWithOptions(server.URL, HTTPAPIClientOptions{})
+
+		order := struct {
+			Id int `json:"id"`
+		}{}
+
+		batch := client.NewBatch()
+		batch.Add("order", "order.get", newTestPayload(map[string]interface{}{"id": 1}), &order)
+		batch.Add("user", "user.get", newTestPayload(map[string]interface{}{"id": 2}), nil)
+		batch.Add("stock", "stock.get", newTestPayload(nil), nil)
+
+		errs, err := batch.Send(context.Background())
+
+		if (err != nil) != c.expectErr {
+			t.Errorf("%s: expect error %v, got %v", c.name, c.expectErr, err)
+		}
+
+		if err == nil {
+			if len(errs) != len(c.expectErrs) {
+				t.Errorf("%s: expect errors of %v, got %v", c.name, c.expectErrs, errs)
+			}
+
+			for callName := range c.expectErrs {
+				if errs[callName] == nil {
+					t.Errorf("%s: expect error of call %s", c.name, callName)
+				}
+			}
+
+			if order.Id != 1 {
+				t.Errorf("%s: expect the result of order decoded, got %v", c.name, order)
+			}
+		}
+
+		if c.expectErrs["stock"] && !ErrAPIClientBatchResponseMissing.IsEqual(errs["stock"]) {
+			t.Errorf("%s: expect the missing response error, got %v", c.name, errs["stock"])
+		}
+
+		client.Close(context.Background())
+		server.Close()
+	}
+}
@@ -0,0 +1,291 @@
+package api_client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gogap/errors"
+)
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+var (
+	DefaultBreakerFailureThreshold = 5
+	DefaultBreakerOpenDuration     = time.Second * 10
+	DefaultBreakerHalfOpenCalls    = 1
+)
+
+type BreakerOptions struct {
+	Disabled bool
+
+	FailureThreshold int
+	OpenDuration     time.Duration
+	HalfOpenCalls    int
+
+	// api error codes counted as failure besides the transport failures,
+	// namespace to codes
+	FailureCodes map[string][]uint64
+
+	// the options of the specific apis
+	APIs map[string]BreakerOptions
+}
+
+func (p *BreakerOptions) initial() {
+	if p.FailureThreshold <= 0 {
+		p.FailureThreshold = DefaultBreakerFailureThreshold
+	}
+
+	if p.OpenDuration <= 0 {
+		p.OpenDuration = DefaultBreakerOpenDuration
+	}
+
+	if p.HalfOpenCalls <= 0 {
+		p.HalfOpenCalls = DefaultBreakerHalfOpenCalls
+	}
+
+	if p.FailureCodes == nil {
+		p.FailureCodes = map[string][]uint64{"JSON_API": {408}}
+	}
+}
+
+func (p *BreakerOptions) optionsOf(apiName string) BreakerOptions {
+	opts, exist := p.APIs[apiName]
+	if !exist {
+		opts = *p
+	}
+
+	opts.APIs = nil
+	opts.initial()
+
+	return opts
+}
+
+type RetryOptions struct {
+	MaxRetries int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// api error codes safe to retry besides the transport failures,
+	// namespace to codes
+	IdempotentCodes map[string][]uint64
+}
+
+func (p *RetryOptions) initial() {
+	if p.MaxRetries < 0 {
+		p.MaxRetries = 0
+	}
+
+	if p.Backoff <= 0 {
+		p.Backoff = DefaultCastRetryBackoff
+	}
+
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultCastMaxRetryBackoff
+	}
+}
+
+func (p *RetryOptions) backoff(attempts int) time.Duration {
+	backoff := p.Backoff
+	for i := 1; i < attempts && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+
+	return backoff
+}
+
+func (p *RetryOptions) isRetryable(err error) bool {
+	return isTransportFailure(err) || inErrCodes(err, p.IdempotentCodes)
+}
+
+type circuitBreaker struct {
+	opts BreakerOptions
+
+	state         BreakerState
+	failures      int
+	openedAt      time.Time
+	halfOpenCalls int
+
+	locker sync.Mutex
+}
+
+func newCircuitBreaker(opts BreakerOptions) *circuitBreaker {
+	return &circuitBreaker{
+		opts:  opts,
+		state: BreakerClosed,
+	}
+}
+
+func (p *circuitBreaker) State() BreakerState {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.state == BreakerOpen && time.Now().Sub(p.openedAt) >= p.opts.OpenDuration {
+		return BreakerHalfOpen
+	}
+
+	return p.state
+}
+
+func (p *circuitBreaker) allow() bool {
+	if p.opts.Disabled {
+		return true
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.state == BreakerOpen {
+		if time.Now().Sub(p.openedAt) < p.opts.OpenDuration {
+			return false
+		}
+
+		p.state = BreakerHalfOpen
+		p.halfOpenCalls = 0
+	}
+
+	if p.state == BreakerHalfOpen {
+		if p.halfOpenCalls >= p.opts.HalfOpenCalls {
+			return false
+		}
+		p.halfOpenCalls++
+	}
+
+	return true
+}
+
+// openRemaining returns the duration until the open breaker half-opens
+func (p *circuitBreaker) openRemaining() time.Duration {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if p.state != BreakerOpen {
+		return 0
+	}
+
+	if remaining := p.opts.OpenDuration - time.Now().Sub(p.openedAt); remaining > 0 {
+		return remaining
+	}
+
+	return 0
+}
+
+func (p *circuitBreaker) record(err error) {
+	if p.opts.Disabled {
+		return
+	}
+
+	failed := isTransportFailure(err) ||
+		isErrCodeOf(err, ErrAPIClientCallDeadlineExceeded.New()) ||
+		inErrCodes(err, p.opts.FailureCodes)
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	switch p.state {
+	case BreakerHalfOpen:
+		if failed {
+			p.open()
+		} else {
+			p.state = BreakerClosed
+			p.failures = 0
+		}
+	case BreakerClosed:
+		if !failed {
+			p.failures = 0
+			return
+		}
+
+		p.failures++
+
+		if p.failures >= p.opts.FailureThreshold {
+			p.open()
+		}
+	}
+}
+
+func (p *circuitBreaker) open() {
+	p.state = BreakerOpen
+	p.openedAt = time.Now()
+	p.failures = 0
+}
+
+// CircuitOpenError is returned while the circuit of api is open, the retry
+// after is the duration until the breaker half-opens
+type CircuitOpenError struct {
+	errors.ErrCode
+	RetryAfter time.Duration
+}
+
+func newCircuitOpenError(apiName string, retryAfter time.Duration) *CircuitOpenError {
+	return &CircuitOpenError{
+		ErrCode:    ErrAPIClientCircuitOpen.New(errors.Params{"api": apiName}),
+		RetryAfter: retryAfter,
+	}
+}
+
+type circuitBreakers struct {
+	opts     BreakerOptions
+	breakers map[string]*circuitBreaker
+	locker   sync.Mutex
+}
+
+func newCircuitBreakers(opts BreakerOptions) *circuitBreakers {
+	return &circuitBreakers{
+		opts:     opts,
+		breakers: make(map[string]*circuitBreaker),
+	}
+}
+
+func (p *circuitBreakers) get(apiName string) *circuitBreaker {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	breaker, exist := p.breakers[apiName]
+	if !exist {
+		breaker = newCircuitBreaker(p.opts.optionsOf(apiName))
+		p.breakers[apiName] = breaker
+	}
+
+	return breaker
+}
+
+func (p *circuitBreakers) states() map[string]BreakerState {
+	p.locker.Lock()
+	breakers := make(map[string]*circuitBreaker, len(p.breakers))
+	for apiName, breaker := range p.breakers {
+		breakers[apiName] = breaker
+	}
+	p.locker.Unlock()
+
+	states := make(map[string]BreakerState, len(breakers))
+	for apiName, breaker := range breakers {
+		states[apiName] = breaker.State()
+	}
+
+	return states
+}
+
+func inErrCodes(err error, codes map[string][]uint64) bool {
+	errCode, ok := err.(errors.ErrCode)
+	if !ok {
+		return false
+	}
+
+	for _, code := range codes[errCode.Namespace()] {
+		if code == errCode.Code() {
+			return true
+		}
+	}
+
+	return false
+}
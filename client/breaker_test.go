@@ -0,0 +1,72 @@
+package api_client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gogap/errors"
+)
+
+func TestCircuitBreakerStates(t *testing.T) {
+	breaker := newCircuitBreaker(BreakerOptions{FailureThreshold: 2, OpenDuration: time.Millisecond * 20, HalfOpenCalls: 1})
+	breaker.opts.initial()
+
+	failure := ErrAPIClientSendFailed.New()
+	apiError := errors.NewErrorCode("", 1001, "ORDER", "out of stock", "", nil)
+
+	steps := []struct {
+		name        string
+		wait        time.Duration
+		expectAllow bool
+		result      error
+		expectState BreakerState
+	}{
+		{"first failure", 0, true, failure, BreakerClosed},
+		{"api error is not failure", 0, true, apiError, BreakerClosed},
+		{"failure after reset", 0, true, failure, BreakerClosed},
+		{"threshold reached", 0, true, failure, BreakerOpen},
+		{"rejected while open", 0, false, nil, BreakerOpen},
+		{"half open probe failed", time.Millisecond * 25, true, failure, BreakerOpen},
+		{"half open probe succeeded", time.Millisecond * 25, true, nil, BreakerClosed},
+		{"closed", 0, true, nil, BreakerClosed},
+	}
+
+	for _, step := range steps {
+		time.Sleep(step.wait)
+
+		allowed := breaker.allow()
+		if allowed != step.expectAllow {
+			t.Fatalf("%s: expect allow %v, got %v", step.name, step.expectAllow, allowed)
+		}
+
+		if allowed {
+			breaker.record(step.result)
+		}
+
+		if state := breaker.State(); state != step.expectState {
+			t.Fatalf("%s: expect state %s, got %s", step.name, step.expectState, state)
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpenCalls(t *testing.T) {
+	breaker := newCircuitBreaker(BreakerOptions{FailureThreshold: 1, OpenDuration: time.Millisecond * 20, HalfOpenCalls: 1})
+	breaker.opts.initial()
+
+	breaker.allow()
+	breaker.record(ErrAPIClientSendFailed.New())
+
+	if remaining := breaker.openRemaining(); remaining <= 0 || remaining > time.Millisecond*20 {
+		t.Errorf("expect the remaining open duration, got %v", remaining)
+	}
+
+	time.Sleep(time.Millisecond * 25)
+
+	if !breaker.allow() {
+		t.Fatalf("expect the probe allowed once half open")
+	}
+
+	if breaker.allow() {
+		t.Errorf("expect the calls more than half open calls rejected")
+	}
+}
@@ -0,0 +1,389 @@
+package api_client
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogap/errors"
+	"github.com/gogap/spirit"
+)
+
+var (
+	DefaultCastQueueSize       = 1024
+	DefaultCastWorkers         = 4
+	DefaultCastMaxRetries      = 3
+	DefaultCastRetryBackoff    = time.Millisecond * 100
+	DefaultCastMaxRetryBackoff = time.Second * 5
+
+	castSpoolScanInterval = time.Second
+)
+
+type CastMessage struct {
+	Id       string      `json:"id"`
+	Api      string      `json:"api"`
+	Payload  JsonPayload `json:"payload"`
+	Attempts int         `json:"attempts"`
+}
+
+// DeadLetterHandler receives the casts which could not be sent
+type DeadLetterHandler func(message CastMessage, err error)
+
+type CastOptions struct {
+	QueueSize  int
+	Workers    int
+	MaxRetries int // negative to disable retry
+
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+
+	DeadLetter DeadLetterHandler
+	SpoolDir   string
+}
+
+func (p *CastOptions) initial() {
+	if p.QueueSize <= 0 {
+		p.QueueSize = DefaultCastQueueSize
+	}
+
+	if p.Workers <= 0 {
+		p.Workers = DefaultCastWorkers
+	}
+
+	if p.MaxRetries < 0 {
+		p.MaxRetries = 0
+	} else if p.MaxRetries == 0 {
+		p.MaxRetries = DefaultCastMaxRetries
+	}
+
+	if p.RetryBackoff <= 0 {
+		p.RetryBackoff = DefaultCastRetryBackoff
+	}
+
+	if p.MaxRetryBackoff <= 0 {
+		p.MaxRetryBackoff = DefaultCastMaxRetryBackoff
+	}
+}
+
+// FileDeadLetter appends the dead casts to file as json lines
+func FileDeadLetter(path string) DeadLetterHandler {
+	locker := sync.Mutex{}
+
+	return func(message CastMessage, err error) {
+		locker.Lock()
+		defer locker.Unlock()
+
+		line, _ := json.Marshal(map[string]interface{}{
+			"time":    time.Now(),
+			"message": message,
+			"error":   err.Error(),
+		})
+
+		f, e := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if e != nil {
+			spirit.Logger().
+				WithField("event", "write dead letter").
+				WithField("path", path).
+				Errorln(e)
+			return
+		}
+		defer f.Close()
+
+		f.Write(append(line, '\n'))
+	}
+}
+
+type castQueue struct {
+	opts CastOptions
+	call func(ctx context.Context, message CastMessage) error
+
+	queue    chan CastMessage
+	inflight map[string]bool
+	closed   bool
+	locker   sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	spoolStopChan chan bool
+	workersWG     sync.WaitGroup
+}
+
+func newCastQueue(opts CastOptions, call func(ctx context.Context, message CastMessage) error) *castQueue {
+	opts.initial()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	queue := &castQueue{
+		opts:          opts,
+		call:          call,
+		queue:         make(chan CastMessage, opts.QueueSize),
+		inflight:      make(map[string]bool),
+		ctx:           ctx,
+		cancel:        cancel,
+		spoolStopChan: make(chan bool),
+	}
+
+	if opts.SpoolDir != "" {
+		if err := os.MkdirAll(opts.SpoolDir, 0755); err != nil {
+			spirit.Logger().
+				WithField("event", "create cast spool dir").
+				WithField("path", opts.SpoolDir).
+				Errorln(err)
+		}
+		go queue.loadSpool()
+	}
+
+	for i := 0; i < opts.Workers; i++ {
+		queue.workersWG.Add(1)
+		go queue.work()
+	}
+
+	return queue
+}
+
+func (p *castQueue) Enqueue(message CastMessage) {
+	p.locker.Lock()
+
+	if p.closed {
+		p.locker.Unlock()
+		p.deadLetter(message, ErrAPIClientClosed.New())
+		return
+	}
+
+	spooled := p.writeSpool(message)
+
+	select {
+	case p.queue <- message:
+		p.inflight[message.Id] = true
+		p.locker.Unlock()
+	default:
+		p.locker.Unlock()
+		// the spooled message will be queued by loadSpool later
+		if !spooled {
+			p.deadLetter(message, ErrAPIClientCastQueueFull.New(errors.Params{"api": message.Api}))
+		}
+	}
+}
+
+func (p *castQueue) Close(ctx context.Context) (err error) {
+	p.locker.Lock()
+	if p.closed {
+		p.locker.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.queue)
+	close(p.spoolStopChan)
+	p.locker.Unlock()
+
+	finished := make(chan bool)
+	go func() {
+		p.workersWG.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		// stop the retries and in-flight calls
+		p.cancel()
+		<-finished
+		err = ctx.Err()
+	}
+
+	p.cancel()
+
+	return
+}
+
+func (p *castQueue) work() {
+	defer p.workersWG.Done()
+
+	for message := range p.queue {
+		p.process(message)
+	}
+}
+
+func (p *castQueue) process(message CastMessage) {
+	defer func() {
+		p.locker.Lock()
+		delete(p.inflight, message.Id)
+		p.locker.Unlock()
+	}()
+
+	for {
+		message.Attempts++
+
+		err := p.call(p.ctx, message)
+		if err == nil {
+			p.removeSpool(message)
+			return
+		}
+
+		if p.ctx.Err() != nil {
+			p.stopped(message)
+			return
+		}
+
+		backoff := p.backoff(message.Attempts)
+
+		// the open circuit is not counted as attempt, the cast waits until
+		// the breaker half-opens
+		if circuitOpenErr, ok := err.(*CircuitOpenError); ok {
+			message.Attempts--
+
+			backoff = circuitOpenErr.RetryAfter
+			if backoff < p.opts.RetryBackoff {
+				backoff = p.opts.RetryBackoff
+			}
+		} else if message.Attempts > p.opts.MaxRetries || !isTransportFailure(err) {
+			p.removeSpool(message)
+			p.deadLetter(message, err)
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-p.ctx.Done():
+			p.stopped(message)
+			return
+		}
+	}
+}
+
+// stopped keeps the message in spool for the next start if possible
+func (p *castQueue) stopped(message CastMessage) {
+	if p.opts.SpoolDir != "" {
+		return
+	}
+	p.deadLetter(message, ErrAPIClientClosed.New())
+}
+
+func (p *castQueue) backoff(attempts int) time.Duration {
+	backoff := p.opts.RetryBackoff
+	for i := 1; i < attempts && backoff < p.opts.MaxRetryBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > p.opts.MaxRetryBackoff {
+		backoff = p.opts.MaxRetryBackoff
+	}
+
+	return backoff
+}
+
+func (p *castQueue) deadLetter(message CastMessage, err error) {
+	if p.opts.DeadLetter != nil {
+		p.opts.DeadLetter(message, err)
+		return
+	}
+
+	spirit.Logger().
+		WithField("event", "cast dead letter").
+		WithField("api", message.Api).
+		WithField("payload_id", message.Payload.Id).
+		WithField("attempts", message.Attempts).
+		Errorln(err)
+}
+
+func (p *castQueue) spoolFile(message CastMessage) string {
+	return filepath.Join(p.opts.SpoolDir, message.Id+".json")
+}
+
+func (p *castQueue) writeSpool(message CastMessage) bool {
+	if p.opts.SpoolDir == "" {
+		return false
+	}
+
+	data, err := json.Marshal(message)
+	if err == nil {
+		err = ioutil.WriteFile(p.spoolFile(message), data, 0644)
+	}
+
+	if err != nil {
+		spirit.Logger().
+			WithField("event", "write cast spool").
+			WithField("api", message.Api).
+			Errorln(err)
+		return false
+	}
+
+	return true
+}
+
+func (p *castQueue) removeSpool(message CastMessage) {
+	if p.opts.SpoolDir == "" {
+		return
+	}
+	os.Remove(p.spoolFile(message))
+}
+
+// loadSpool queues the spooled casts left by last run or overflowed queue
+func (p *castQueue) loadSpool() {
+	ticker := time.NewTicker(castSpoolScanInterval)
+	defer ticker.Stop()
+
+	for {
+		p.queueSpooled()
+
+		select {
+		case <-ticker.C:
+		case <-p.spoolStopChan:
+			return
+		}
+	}
+}
+
+func (p *castQueue) queueSpooled() {
+	files, err := filepath.Glob(filepath.Join(p.opts.SpoolDir, "*.json"))
+	if err != nil {
+		return
+	}
+
+	for _, file := range files {
+		id := strings.TrimSuffix(filepath.Base(file), ".json")
+
+		p.locker.Lock()
+
+		if p.closed {
+			p.locker.Unlock()
+			return
+		}
+
+		if p.inflight[id] {
+			p.locker.Unlock()
+			continue
+		}
+
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			p.locker.Unlock()
+			continue
+		}
+
+		message := CastMessage{}
+		if err = json.Unmarshal(data, &message); err != nil || message.Id != id {
+			p.locker.Unlock()
+			spirit.Logger().
+				WithField("event", "load cast spool").
+				WithField("path", file).
+				Errorln("bad spooled cast")
+			continue
+		}
+
+		select {
+		case p.queue <- message:
+			p.inflight[id] = true
+			p.locker.Unlock()
+		default:
+			p.locker.Unlock()
+			return
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package api_client
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCastQueueWaitsCircuitOpen(t *testing.T) {
+	calls := 0
+	sent := make(chan CastMessage, 1)
+	deadLetters := make(chan error, 1)
+
+	call := func(ctx context.Context, message CastMessage) error {
+		calls++
+		if calls <= 3 {
+			return newCircuitOpenError(message.Api, time.Millisecond*10)
+		}
+		sent <- message
+		return nil
+	}
+
+	queue := newCastQueue(CastOptions{
+		Workers:      1,
+		MaxRetries:   1,
+		RetryBackoff: time.Millisecond,
+		DeadLetter: func(message CastMessage, err error) {
+			deadLetters <- err
+		},
+	}, call)
+	defer queue.Close(context.Background())
+
+	queue.Enqueue(CastMessage{Id: "m1", Api: "order.notify"})
+
+	select {
+	case message := <-sent:
+		if message.Attempts != 1 {
+			t.Errorf("expect the open circuit not counted as attempt, got %d attempts", message.Attempts)
+		}
+	case err := <-deadLetters:
+		t.Fatalf("expect the cast sent once the circuit half-opened, got dead letter %v", err)
+	case <-time.After(time.Second):
+		t.Fatalf("expect the cast sent")
+	}
+}
+
+func TestCastQueueDeadLetter(t *testing.T) {
+	deadLetters := make(chan CastMessage, 1)
+
+	call := func(ctx context.Context, message CastMessage) error {
+		return ErrAPIClientSendFailed.New()
+	}
+
+	queue := newCastQueue(CastOptions{
+		Workers:      1,
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+		DeadLetter: func(message CastMessage, err error) {
+			deadLetters <- message
+		},
+	}, call)
+	defer queue.Close(context.Background())
+
+	queue.Enqueue(CastMessage{Id: "m1", Api: "order.notify"})
+
+	select {
+	case message := <-deadLetters:
+		if message.Attempts != 3 {
+			t.Errorf("expect 3 attempts, got %d", message.Attempts)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expect the cast dead lettered")
+	}
+}
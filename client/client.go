@@ -1,6 +1,8 @@
 package api_client
 
 import (
+	"context"
+
 	"github.com/gogap/spirit"
 )
 
@@ -8,3 +10,16 @@ type APIClient interface {
 	Call(apiName string, payload spirit.Payload, v interface{}) (err error)
 	Cast(apiName string, payload spirit.Payload)
 }
+
+// ContextAPIClient is the api client with deadline and cancellation, the
+// methods of APIClient are the wrappers with background context
+type ContextAPIClient interface {
+	APIClient
+
+	CallWithContext(ctx context.Context, apiName string, payload spirit.Payload, v interface{}) (err error)
+	CastWithContext(ctx context.Context, apiName string, payload spirit.Payload)
+
+	NewBatch() *Batch
+
+	Close(ctx context.Context) (err error)
+}
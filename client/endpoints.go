@@ -0,0 +1,244 @@
+package api_client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	BalanceRoundRobin    = "round_robin"
+	BalanceLeastInflight = "least_inflight"
+)
+
+var (
+	DefaultEjectThreshold      = 5
+	DefaultEjectDuration       = time.Second * 30
+	DefaultHealthCheckPath     = "/ping"
+	DefaultHealthCheckInterval = time.Second * 10
+	DefaultHealthCheckTimeout  = time.Second * 2
+)
+
+type EndpointOptions struct {
+	Balance string
+
+	// passive outlier ejection
+	EjectThreshold int
+	EjectDuration  time.Duration
+
+	// active health check, negative interval to disable
+	HealthCheckPath     string
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+}
+
+func (p *EndpointOptions) initial() {
+	if p.Balance == "" {
+		p.Balance = BalanceRoundRobin
+	}
+
+	if p.EjectThreshold <= 0 {
+		p.EjectThreshold = DefaultEjectThreshold
+	}
+
+	if p.EjectDuration <= 0 {
+		p.EjectDuration = DefaultEjectDuration
+	}
+
+	if p.HealthCheckPath == "" {
+		p.HealthCheckPath = DefaultHealthCheckPath
+	}
+
+	if p.HealthCheckInterval == 0 {
+		p.HealthCheckInterval = DefaultHealthCheckInterval
+	}
+
+	if p.HealthCheckTimeout <= 0 {
+		p.HealthCheckTimeout = DefaultHealthCheckTimeout
+	}
+}
+
+type endpoint struct {
+	url     string
+	pingURL string
+
+	inflight int64
+
+	failures     int
+	ejectedUntil time.Time
+	unhealthy    bool
+	locker       sync.Mutex
+}
+
+func (p *endpoint) isAvailable(now time.Time) bool {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	return !p.unhealthy && !now.Before(p.ejectedUntil)
+}
+
+type endpointPool struct {
+	opts      EndpointOptions
+	endpoints []*endpoint
+	next      uint64
+
+	client   *http.Client
+	stopChan chan bool
+	stopOnce sync.Once
+}
+
+func newEndpointPool(urls []string, opts EndpointOptions) *endpointPool {
+	opts.initial()
+
+	pool := &endpointPool{
+		opts:     opts,
+		client:   &http.Client{Timeout: opts.HealthCheckTimeout},
+		stopChan: make(chan bool),
+	}
+
+	for _, strURL := range urls {
+		strURL = strings.TrimSpace(strURL)
+		if strURL == "" {
+			continue
+		}
+
+		ep := &endpoint{url: strURL}
+
+		if u, err := url.Parse(strURL); err == nil {
+			ep.pingURL = u.Scheme + "://" + u.Host + opts.HealthCheckPath
+		}
+
+		pool.endpoints = append(pool.endpoints, ep)
+	}
+
+	if len(pool.endpoints) == 0 {
+		panic("url could not be nil")
+	}
+
+	if opts.HealthCheckInterval > 0 && len(pool.endpoints) > 1 {
+		go pool.healthCheck()
+	}
+
+	return pool
+}
+
+func (p *endpointPool) String() string {
+	urls := []string{}
+	for _, ep := range p.endpoints {
+		urls = append(urls, ep.url)
+	}
+	return strings.Join(urls, ",")
+}
+
+// pick returns an available endpoint, all of the endpoints are candidates if
+// none of them is available
+func (p *endpointPool) pick() *endpoint {
+	if len(p.endpoints) == 1 {
+		return p.endpoints[0]
+	}
+
+	now := time.Now()
+
+	candidates := []*endpoint{}
+	for _, ep := range p.endpoints {
+		if ep.isAvailable(now) {
+			candidates = append(candidates, ep)
+		}
+	}
+
+	if len(candidates) == 0 {
+		candidates = p.endpoints
+	}
+
+	next := atomic.AddUint64(&p.next, 1)
+
+	if p.opts.Balance != BalanceLeastInflight {
+		return candidates[next%uint64(len(candidates))]
+	}
+
+	// start from the round robin position, so the idle endpoints share the load
+	offset := int(next % uint64(len(candidates)))
+	picked := candidates[offset]
+	for i := 1; i < len(candidates); i++ {
+		ep := candidates[(offset+i)%len(candidates)]
+		if atomic.LoadInt64(&ep.inflight) < atomic.LoadInt64(&picked.inflight) {
+			picked = ep
+		}
+	}
+
+	return picked
+}
+
+func (p *endpointPool) acquire(ep *endpoint) {
+	atomic.AddInt64(&ep.inflight, 1)
+}
+
+// release reports the result of the call, the endpoint is ejected after
+// continuous send failures or bad status codes
+func (p *endpointPool) release(ep *endpoint, err error) {
+	atomic.AddInt64(&ep.inflight, -1)
+
+	ep.locker.Lock()
+	defer ep.locker.Unlock()
+
+	if !isTransportFailure(err) {
+		ep.failures = 0
+		return
+	}
+
+	ep.failures++
+
+	if ep.failures >= p.opts.EjectThreshold {
+		ep.failures = 0
+		ep.ejectedUntil = time.Now().Add(p.opts.EjectDuration)
+	}
+}
+
+func (p *endpointPool) healthCheck() {
+	ticker := time.NewTicker(p.opts.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, ep := range p.endpoints {
+				healthy := p.ping(ep)
+
+				ep.locker.Lock()
+				ep.unhealthy = !healthy
+				ep.locker.Unlock()
+			}
+		case <-p.stopChan:
+			return
+		}
+	}
+}
+
+func (p *endpointPool) ping(ep *endpoint) bool {
+	if ep.pingURL == "" {
+		return true
+	}
+
+	resp, err := p.client.Get(ep.pingURL)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false
+	}
+
+	return resp.StatusCode == http.StatusOK && strings.TrimSpace(string(body)) == "pong"
+}
+
+func (p *endpointPool) Close() {
+	p.stopOnce.Do(func() {
+		close(p.stopChan)
+	})
+}
@@ -0,0 +1,169 @@
+package api_client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gogap/errors"
+)
+
+func newTestEndpointPool(urls []string, opts EndpointOptions) *endpointPool {
+	// negative interval to test pick and release without health check
+	if opts.HealthCheckInterval == 0 {
+		opts.HealthCheckInterval = -1
+	}
+	return newEndpointPool(urls, opts)
+}
+
+func pickURLs(pool *endpointPool, n int) map[string]int {
+	picked := map[string]int{}
+	for i := 0; i < n; i++ {
+		picked[pool.pick().url]++
+	}
+	return picked
+}
+
+func TestEndpointPoolRoundRobin(t *testing.T) {
+	pool := newTestEndpointPool([]string{"http://a", " ", "http://b", "http://c"}, EndpointOptions{})
+	defer pool.Close()
+
+	if len(pool.endpoints) != 3 || pool.String() != "http://a,http://b,http://c" {
+		t.Fatalf("expect the blank url skipped, got %s", pool)
+	}
+
+	picked := pickURLs(pool, 30)
+	for _, ep := range pool.endpoints {
+		if picked[ep.url] != 10 {
+			t.Errorf("expect the calls balanced, got %v", picked)
+		}
+	}
+}
+
+func TestEndpointPoolLeastInflight(t *testing.T) {
+	pool := newTestEndpointPool([]string{"http://a", "http://b", "http://c"}, EndpointOptions{Balance: BalanceLeastInflight})
+	defer pool.Close()
+
+	busy := pool.endpoints[0]
+	pool.acquire(busy)
+	pool.acquire(busy)
+
+	picked := pickURLs(pool, 20)
+	if picked[busy.url] != 0 || picked["http://b"] == 0 || picked["http://c"] == 0 {
+		t.Errorf("expect the idle endpoints share the calls, got %v", picked)
+	}
+
+	pool.release(busy, nil)
+	pool.release(busy, nil)
+
+	if picked := pickURLs(pool, 30); picked[busy.url] != 10 {
+		t.Errorf("expect the released endpoint picked again, got %v", picked)
+	}
+}
+
+func TestEndpointPoolOutlierEjection(t *testing.T) {
+	pool := newTestEndpointPool([]string{"http://a", "http://b"}, EndpointOptions{EjectThreshold: 2, EjectDuration: time.Millisecond * 50})
+	defer pool.Close()
+
+	bad := pool.endpoints[0]
+
+	steps := []struct {
+		name        string
+		result      error
+		expectEject bool
+	}{
+		{"first failure", ErrAPIClientSendFailed.New(), false},
+		{"api error resets failures", errors.NewErrorCode("", 1001, "ORDER", "out of stock", "", nil), false},
+		{"failure after reset", ErrAPIClientBadStatusCode.New(), false},
+		{"threshold reached", ErrAPIClientSendFailed.New(), true},
+	}
+
+	for _, step := range steps {
+		pool.acquire(bad)
+		pool.release(bad, step.result)
+
+		if ejected := !bad.isAvailable(time.Now()); ejected != step.expectEject {
+			t.Fatalf("%s: expect ejected %v, got %v", step.name, step.expectEject, ejected)
+		}
+	}
+
+	if picked := pickURLs(pool, 10); picked[bad.url] != 0 {
+		t.Errorf("expect the ejected endpoint not picked, got %v", picked)
+	}
+
+	// all of the endpoints are candidates if none of them is available
+	pool.endpoints[1].ejectedUntil = time.Now().Add(time.Minute)
+	if picked := pickURLs(pool, 10); picked[bad.url] != 5 {
+		t.Errorf("expect all endpoints picked if none available, got %v", picked)
+	}
+	pool.endpoints[1].ejectedUntil = time.Time{}
+
+	time.Sleep(time.Millisecond * 60)
+
+	if picked := pickURLs(pool, 10); picked[bad.url] != 5 {
+		t.Errorf("expect the endpoint re-admitted after eject duration, got %v", picked)
+	}
+}
+
+func TestEndpointPoolHealthCheck(t *testing.T) {
+	var healthy int32 = 1
+
+	newServer := func(healthy *int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/health" || atomic.LoadInt32(healthy) == 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("pong\n"))
+		}))
+	}
+
+	alwaysHealthy := int32(1)
+
+	flaky := newServer(&healthy)
+	defer flaky.Close()
+
+	stable := newServer(&alwaysHealthy)
+	defer stable.Close()
+
+	pool := newEndpointPool([]string{flaky.URL + "/api", stable.URL + "/api"}, EndpointOptions{
+		HealthCheckPath:     "/health",
+		HealthCheckInterval: time.Millisecond * 10,
+	})
+	defer pool.Close()
+
+	flakyEndpoint := pool.endpoints[0]
+
+	waitAvailable := func(expect bool) bool {
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			if flakyEndpoint.isAvailable(time.Now()) == expect {
+				return true
+			}
+			time.Sleep(time.Millisecond * 5)
+		}
+		return false
+	}
+
+	atomic.StoreInt32(&healthy, 0)
+
+	if !waitAvailable(false) {
+		t.Fatalf("expect the endpoint marked unhealthy")
+	}
+
+	if picked := pickURLs(pool, 10); picked[flakyEndpoint.url] != 0 {
+		t.Errorf("expect the unhealthy endpoint not picked, got %v", picked)
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+
+	if !waitAvailable(true) {
+		t.Fatalf("expect the endpoint recovered by health check")
+	}
+
+	if !pool.endpoints[1].isAvailable(time.Now()) {
+		t.Errorf("expect the stable endpoint kept healthy")
+	}
+}
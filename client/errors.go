@@ -20,4 +20,33 @@ var (
 	ErrAPIClientCreateNewRequestFailed = errors.TN(JsonApiClientErrorNamespace, 6, "create new request failed")
 
 	ErrUnknownPayloadError = errors.TN(JsonApiClientErrorNamespace, 7, "")
+
+	ErrAPIClientCallCanceled         = errors.TN(JsonApiClientErrorNamespace, 8, "api call canceled, api: {{.api}}, url: {{.url}}")
+	ErrAPIClientCallDeadlineExceeded = errors.TN(JsonApiClientErrorNamespace, 9, "api call deadline exceeded, api: {{.api}}, url: {{.url}}")
+
+	ErrAPIClientCastQueueFull = errors.TN(JsonApiClientErrorNamespace, 10, "cast queue is full, api: {{.api}}")
+	ErrAPIClientClosed        = errors.TN(JsonApiClientErrorNamespace, 11, "api client closed")
+	ErrAPIClientCircuitOpen   = errors.TN(JsonApiClientErrorNamespace, 12, "circuit of api {{.api}} is open")
+
+	ErrAPIClientBatchCallDuplicated  = errors.TN(JsonApiClientErrorNamespace, 13, "call name {{.call}} is duplicated in batch")
+	ErrAPIClientBatchResponseMissing = errors.TN(JsonApiClientErrorNamespace, 14, "response of call {{.call}} is missing in batch response")
 )
+
+func isTransportFailure(err error) bool {
+	return isErrCodeOf(err, ErrAPIClientSendFailed.New(), ErrAPIClientBadStatusCode.New())
+}
+
+func isErrCodeOf(err error, errCodes ...errors.ErrCode) bool {
+	errCode, ok := err.(errors.ErrCode)
+	if !ok {
+		return false
+	}
+
+	for _, e := range errCodes {
+		if errCode.Namespace() == e.Namespace() && errCode.Code() == e.Code() {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,15 +2,18 @@ package api_client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gogap/errors"
 	"github.com/gogap/spirit"
 	"github.com/mreiferson/go-httpclient"
+	"github.com/rs/xid"
 )
 
 var (
@@ -18,27 +21,72 @@ var (
 )
 
 const (
-	HeaderForwardedPayload = "X-Forwarded-Payload"
+	HeaderForwardedPayload  = "X-Forwarded-Payload"
+	HeaderForwardedResponse = "X-Forwarded-Response"
+	HeaderApiCallTimeout    = "X-Api-Call-Timeout"
 )
 
+type HTTPAPIClientOptions struct {
+	APIHeaderName           string
+	MultiCallHeaderName     string
+	CorrelationIdHeaderName string
+	Timeout                 time.Duration
+	Cast                    CastOptions
+	Endpoint                EndpointOptions
+	Breaker                 BreakerOptions
+	Retry                   RetryOptions
+	Sign                    SignOptions
+
+	// apply the context, errors and data updated by the remote component
+	// to the payload of Call
+	ForwardedResponse bool
+}
+
 type HTTPAPIClient struct {
-	apiHeaderName string
-	url           string
-	client        *http.Client
+	apiHeaderName           string
+	multiCallHeaderName     string
+	correlationIdHeaderName string
+	forwardedResponse       bool
+	sign                    SignOptions
+	endpoints               *endpointPool
+	client                  *http.Client
+
+	castQueue *castQueue
+	breakers  *circuitBreakers
+	retry     RetryOptions
 }
 
 func NewHTTPAPIClient(url string, apiHeaderName string, timeout time.Duration) APIClient {
-	url = strings.TrimSpace(url)
-	apiHeaderName = strings.TrimSpace(apiHeaderName)
+	return NewHTTPAPIClientWithOptions(url, HTTPAPIClientOptions{
+		APIHeaderName: apiHeaderName,
+		Timeout:       timeout,
+	})
+}
 
-	if url == "" {
-		panic("url could not be nil")
-	}
+func NewHTTPAPIClientWithOptions(url string, opts HTTPAPIClientOptions) ContextAPIClient {
+	return NewHTTPAPIClientWithEndpoints([]string{url}, opts)
+}
+
+// NewHTTPAPIClientWithEndpoints creates client balancing the calls between
+// the receivers of urls
+func NewHTTPAPIClientWithEndpoints(urls []string, opts HTTPAPIClientOptions) ContextAPIClient {
+	apiHeaderName := strings.TrimSpace(opts.APIHeaderName)
+	multiCallHeaderName := strings.TrimSpace(opts.MultiCallHeaderName)
+	correlationIdHeaderName := strings.TrimSpace(opts.CorrelationIdHeaderName)
+	timeout := opts.Timeout
 
 	if apiHeaderName == "" {
 		apiHeaderName = "X-Api"
 	}
 
+	if multiCallHeaderName == "" {
+		multiCallHeaderName = "X-Api-Multi-Call"
+	}
+
+	if correlationIdHeaderName == "" {
+		correlationIdHeaderName = "X-Correlation-Id"
+	}
+
 	if timeout <= 0 {
 		timeout = DefaultClientTimeout
 	}
@@ -50,14 +98,29 @@ func NewHTTPAPIClient(url string, apiHeaderName string, timeout time.Duration) A
 	}
 
 	apiClient := HTTPAPIClient{
-		apiHeaderName: apiHeaderName,
-		url:           url,
-		client:        &http.Client{Transport: transport},
+		apiHeaderName:           apiHeaderName,
+		multiCallHeaderName:     multiCallHeaderName,
+		correlationIdHeaderName: correlationIdHeaderName,
+		forwardedResponse:       opts.ForwardedResponse,
+		sign:                    opts.Sign,
+		endpoints:               newEndpointPool(urls, opts.Endpoint),
+		client:                  &http.Client{Transport: transport},
 	}
+
+	opts.Retry.initial()
+
+	apiClient.breakers = newCircuitBreakers(opts.Breaker)
+	apiClient.retry = opts.Retry
+	apiClient.castQueue = newCastQueue(opts.Cast, apiClient.castCall)
+
 	return &apiClient
 }
 
 func (p *HTTPAPIClient) Call(apiName string, payload spirit.Payload, v interface{}) (err error) {
+	return p.CallWithContext(context.Background(), apiName, payload, v)
+}
+
+func (p *HTTPAPIClient) CallWithContext(ctx context.Context, apiName string, payload spirit.Payload, v interface{}) (err error) {
 	apiName = strings.TrimSpace(apiName)
 
 	if apiName == "" {
@@ -65,59 +128,82 @@ func (p *HTTPAPIClient) Call(apiName string, payload spirit.Payload, v interface
 		return
 	}
 
-	var payloadData interface{}
-
-	if payloadData, err = payload.GetData(); err != nil {
+	var jsonPayload JsonPayload
+	if jsonPayload, err = toJsonPayload(payload); err != nil {
 		return
 	}
 
-	jsonPayload := JsonPayload{
-		Id:      payload.Id(),
-		Data:    payloadData,
-		Errors:  payload.Errors(),
-		Context: payload.Context(),
+	return p.call(ctx, apiName, jsonPayload, payload, v)
+}
+
+// call retries the transport failures and the idempotent api errors
+func (p *HTTPAPIClient) call(ctx context.Context, apiName string, jsonPayload JsonPayload, payload spirit.Payload, v interface{}) (err error) {
+	for attempts := 1; ; attempts++ {
+		if err = p.callOnce(ctx, apiName, jsonPayload, payload, v); err == nil {
+			return
+		}
+
+		if attempts > p.retry.MaxRetries || !p.retry.isRetryable(err) {
+			return
+		}
+
+		select {
+		case <-time.After(p.retry.backoff(attempts)):
+		case <-ctx.Done():
+			return
+		}
 	}
+}
 
-	var data []byte
-	if data, err = json.Marshal(jsonPayload); err != nil {
+func (p *HTTPAPIClient) callOnce(ctx context.Context, apiName string, jsonPayload JsonPayload, payload spirit.Payload, v interface{}) (err error) {
+	breaker := p.breakers.get(apiName)
+
+	if !breaker.allow() {
+		err = newCircuitOpenError(apiName, breaker.openRemaining())
 		return
 	}
 
-	postBodyReader := bytes.NewReader(data)
+	defer func() {
+		breaker.record(err)
+	}()
 
-	var req *http.Request
-	if req, err = http.NewRequest("POST", p.url, postBodyReader); err != nil {
-		err = ErrAPIClientCreateNewRequestFailed.New().Append(err)
+	ep := p.endpoints.pick()
+
+	p.endpoints.acquire(ep)
+	defer func() {
+		p.endpoints.release(ep, err)
+	}()
+
+	return p.callEndpoint(ctx, ep.url, apiName, jsonPayload, payload, v)
+}
+
+// callEndpoint decodes the result into v, the payload is updated by the
+// forwarded response if the forwarded response mode is on
+func (p *HTTPAPIClient) callEndpoint(ctx context.Context, url string, apiName string, jsonPayload JsonPayload, payload spirit.Payload, v interface{}) (err error) {
+	var data []byte
+	if data, err = json.Marshal(jsonPayload); err != nil {
 		return
 	}
 
-	req.Header.Add(p.apiHeaderName, apiName)
-	req.Header.Add(HeaderForwardedPayload, "on")
+	header := http.Header{}
+	header.Set(p.apiHeaderName, apiName)
 
-	var resp *http.Response
-	if resp, err = p.client.Do(req); err != nil {
-		err = ErrAPIClientSendFailed.New(errors.Params{"api": apiName, "url": p.url})
-		return
+	if p.forwardedResponse && payload != nil {
+		header.Set(HeaderForwardedResponse, "on")
 	}
 
-	var body []byte
+	injectTraceContext(ctx, header, jsonPayload.Context)
+	injectCorrelationId(header, p.correlationIdHeaderName, jsonPayload.Context)
 
-	if resp != nil {
-		defer resp.Body.Close()
+	p.sign.sign(header, apiName, data)
 
-		if bBody, e := ioutil.ReadAll(resp.Body); e != nil {
-			err = ErrAPIClientReadResponseBodyFailed.New(errors.Params{"api": apiName}).Append(e)
-			return
-		} else if resp.StatusCode != http.StatusOK {
-			err = ErrAPIClientBadStatusCode.New(errors.Params{"api": apiName, "code": resp.StatusCode})
-			return
-		} else {
-			body = bBody
-		}
+	var body []byte
+	if body, err = p.post(ctx, url, apiName, header, false, data); err != nil {
+		return
+	}
 
-		if v == nil {
-			return
-		}
+	if p.forwardedResponse && payload != nil {
+		return p.applyForwardedResponse(url, apiName, body, payload, v)
 	}
 
 	if v == nil {
@@ -135,20 +221,215 @@ func (p *HTTPAPIClient) Call(apiName string, payload spirit.Payload, v interface
 	tmpResp.Result = v
 
 	if e := json.Unmarshal(body, &tmpResp); e != nil {
-		err = ErrAPIClientResponseUnmarshalFailed.New(errors.Params{"api": apiName, "url": p.url}).Append(e)
+		err = ErrAPIClientResponseUnmarshalFailed.New(errors.Params{"api": apiName, "url": url}).Append(e)
 		return
 	}
 
-	if tmpResp.Code == 0 {
+	if tmpResp.Code != 0 {
+		err = errors.NewErrorCode(tmpResp.ErrorId, tmpResp.Code, tmpResp.ErrorNamespace, tmpResp.Message, "", nil)
+	}
+
+	return
+}
+
+// applyForwardedResponse applies the payload of response to the payload of
+// caller even if the api failed, the errors appended by the remote
+// component are kept as they were appended locally
+func (p *HTTPAPIClient) applyForwardedResponse(url string, apiName string, body []byte, payload spirit.Payload, v interface{}) (err error) {
+	var tmpResp struct {
+		Code           uint64       `json:"code"`
+		ErrorId        string       `json:"error_id,omitempty"`
+		ErrorNamespace string       `json:"error_namespace,omitempty"`
+		Message        string       `json:"message"`
+		Result         *JsonPayload `json:"result"`
+	}
+
+	if e := json.Unmarshal(body, &tmpResp); e != nil {
+		err = ErrAPIClientResponseUnmarshalFailed.New(errors.Params{"api": apiName, "url": url}).Append(e)
 		return
-	} else {
+	}
+
+	if tmpResp.Result != nil {
+		if err = applyJsonPayload(payload, *tmpResp.Result); err != nil {
+			return
+		}
+	}
+
+	if tmpResp.Code != 0 {
 		err = errors.NewErrorCode(tmpResp.ErrorId, tmpResp.Code, tmpResp.ErrorNamespace, tmpResp.Message, "", nil)
 		return
 	}
 
+	if v == nil || tmpResp.Result == nil {
+		return
+	}
+
+	var data []byte
+	if data, err = json.Marshal(tmpResp.Result.Data); err != nil {
+		return
+	}
+
+	if e := json.Unmarshal(data, v); e != nil {
+		err = ErrAPIClientResponseUnmarshalFailed.New(errors.Params{"api": apiName, "url": url}).Append(e)
+		return
+	}
+
+	return
+}
+
+// post sends the forwarded payloads to url and returns the response body, the
+// multi call envelope of partial failures and the forwarded response of failed
+// api are accepted with non-200 status code
+func (p *HTTPAPIClient) post(ctx context.Context, url string, apiName string, header http.Header, isMultiCall bool, data []byte) (body []byte, err error) {
+	var req *http.Request
+	if req, err = http.NewRequest("POST", url, bytes.NewReader(data)); err != nil {
+		err = ErrAPIClientCreateNewRequestFailed.New().Append(err)
+		return
+	}
+
+	req = req.WithContext(ctx)
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	req.Header.Set(HeaderForwardedPayload, "on")
+
+	// let the server stop waiting for the response once the caller gave up
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := deadline.Sub(time.Now()) / time.Millisecond
+		if remaining <= 0 {
+			err = ErrAPIClientCallDeadlineExceeded.New(errors.Params{"api": apiName, "url": url})
+			return
+		}
+		req.Header.Set(HeaderApiCallTimeout, strconv.FormatInt(int64(remaining), 10))
+	}
+
+	var resp *http.Response
+	if resp, err = p.client.Do(req); err != nil {
+		switch ctx.Err() {
+		case context.Canceled:
+			err = ErrAPIClientCallCanceled.New(errors.Params{"api": apiName, "url": url}).Append(err)
+		case context.DeadlineExceeded:
+			err = ErrAPIClientCallDeadlineExceeded.New(errors.Params{"api": apiName, "url": url}).Append(err)
+		default:
+			err = ErrAPIClientSendFailed.New(errors.Params{"api": apiName, "url": url})
+		}
+		return
+	}
+
+	defer resp.Body.Close()
+
+	if body, err = ioutil.ReadAll(resp.Body); err != nil {
+		err = ErrAPIClientReadResponseBodyFailed.New(errors.Params{"api": apiName}).Append(err)
+		return
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		return
+	}
+
+	// the receiver maps api errors to http status codes, keep the api error if the body has one
+	var errResp struct {
+		Code           uint64          `json:"code"`
+		ErrorId        string          `json:"error_id,omitempty"`
+		ErrorNamespace string          `json:"error_namespace,omitempty"`
+		Message        string          `json:"message"`
+		Result         json.RawMessage `json:"result"`
+	}
+
+	if e := json.Unmarshal(body, &errResp); e == nil {
+		// the forwarded response of failed api is applied by the caller
+		if header.Get(HeaderForwardedResponse) != "" && (errResp.Code != 0 || len(errResp.Result) > 0) {
+			return
+		}
+
+		if errResp.Code != 0 {
+			err = errors.NewErrorCode(errResp.ErrorId, errResp.Code, errResp.ErrorNamespace, errResp.Message, "", nil)
+			return
+		}
+
+		if isMultiCall && len(errResp.Result) > 0 && string(errResp.Result) != "null" {
+			return
+		}
+	}
+
+	err = ErrAPIClientBadStatusCode.New(errors.Params{"api": apiName, "code": resp.StatusCode})
+
 	return
 }
 
 func (p *HTTPAPIClient) Cast(apiName string, payload spirit.Payload) {
-	go p.Call(apiName, payload, nil)
+	p.CastWithContext(context.Background(), apiName, payload)
+}
+
+// CastWithContext queues the call, the ctx is only checked while queuing,
+// the queued call is sent by the workers in the background
+func (p *HTTPAPIClient) CastWithContext(ctx context.Context, apiName string, payload spirit.Payload) {
+	apiName = strings.TrimSpace(apiName)
+
+	jsonPayload, err := toJsonPayload(payload)
+
+	message := CastMessage{
+		Id:      xid.New().String(),
+		Api:     apiName,
+		Payload: jsonPayload,
+	}
+
+	if err != nil {
+		p.castQueue.deadLetter(message, err)
+		return
+	}
+
+	if apiName == "" {
+		p.castQueue.deadLetter(message, ErrAPINameIsEmpty.New())
+		return
+	}
+
+	if ctx.Err() != nil {
+		p.castQueue.deadLetter(message, ErrAPIClientCallCanceled.New(errors.Params{"api": apiName, "url": p.endpoints.String()}).Append(ctx.Err()))
+		return
+	}
+
+	p.castQueue.Enqueue(message)
+}
+
+// Close stops accepting casts and waits the queued casts to be sent until
+// the ctx is done, the unsent casts are kept in spool dir if configured
+func (p *HTTPAPIClient) Close(ctx context.Context) (err error) {
+	defer p.endpoints.Close()
+
+	return p.castQueue.Close(ctx)
+}
+
+// BreakerState returns the circuit breaker state of api
+func (p *HTTPAPIClient) BreakerState(apiName string) BreakerState {
+	return p.breakers.get(apiName).State()
+}
+
+// BreakerStates returns the circuit breaker states of the called apis
+func (p *HTTPAPIClient) BreakerStates() map[string]BreakerState {
+	return p.breakers.states()
+}
+
+// castCall is retried by the cast queue, so the retry policy is skipped
+func (p *HTTPAPIClient) castCall(ctx context.Context, message CastMessage) (err error) {
+	return p.callOnce(ctx, message.Api, message.Payload, nil, nil)
+}
+
+func toJsonPayload(payload spirit.Payload) (jsonPayload JsonPayload, err error) {
+	var payloadData interface{}
+
+	if payloadData, err = payload.GetData(); err != nil {
+		return
+	}
+
+	jsonPayload = JsonPayload{
+		Id:      payload.Id(),
+		Data:    payloadData,
+		Errors:  payload.Errors(),
+		Context: payload.Context(),
+	}
+
+	return
 }
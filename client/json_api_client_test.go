@@ -0,0 +1,131 @@
+package api_client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gogap/errors"
+	"github.com/gogap/spirit"
+)
+
+type testPayload struct {
+	id      string
+	data    interface{}
+	errs    []*spirit.Error
+	context spirit.Map
+}
+
+func newTestPayload(data interface{}) *testPayload {
+	return &testPayload{id: "payload-id", data: data, context: spirit.Map{}}
+}
+
+func (p *testPayload) Id() string                       { return p.id }
+func (p *testPayload) GetData() (interface{}, error)    { return p.data, nil }
+func (p *testPayload) DataToObject(v interface{}) error { return nil }
+func (p *testPayload) SetData(data interface{}) error   { p.data = data; return nil }
+func (p *testPayload) Errors() []*spirit.Error          { return p.errs }
+func (p *testPayload) AppendError(err ...*spirit.Error) { p.errs = append(p.errs, err...) }
+func (p *testPayload) ClearErrors()                     { p.errs = nil }
+func (p *testPayload) Context() spirit.Map              { return p.context }
+func (p *testPayload) DeleteContext(name string) error  { delete(p.context, name); return nil }
+func (p *testPayload) SetContext(name string, v interface{}) error {
+	p.context[name] = v
+	return nil
+}
+
+func (p *testPayload) LastError() *spirit.Error {
+	if len(p.errs) == 0 {
+		return nil
+	}
+	return p.errs[len(p.errs)-1]
+}
+
+func (p *testPayload) GetContext(name string) (v interface{}, exist bool) {
+	v, exist = p.context[name]
+	return
+}
+
+func TestForwardedResponseOfFailedApi(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(HeaderForwardedResponse) == "" {
+			t.Errorf("forwarded response header not sent")
+		}
+
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"code":1001,"error_namespace":"ORDER","message":"out of stock","result":{"id":"payload-id","data":{"sku":"a"},"errors":[{"namespace":"ORDER","code":1001,"message":"out of stock"}],"context":{"stock":0}}}`))
+	}))
+	defer server.Close()
+
+	client := NewHTTPAPIClientWithOptions(server.URL, HTTPAPIClientOptions{ForwardedResponse: true})
+
+	payload := newTestPayload(map[string]interface{}{"sku": "a"})
+
+	err := client.Call("order.create", payload, nil)
+
+	errCode, ok := err.(errors.ErrCode)
+	if !ok || errCode.Code() != 1001 || errCode.Namespace() != "ORDER" {
+		t.Fatalf("expect the api error of response, got %v", err)
+	}
+
+	if len(payload.Errors()) != 1 || payload.Errors()[0].Code != 1001 {
+		t.Errorf("errors of forwarded response not applied: %v", payload.Errors())
+	}
+
+	if stock, exist := payload.GetContext("stock"); !exist || stock != float64(0) {
+		t.Errorf("context of forwarded response not applied: %v", payload.Context())
+	}
+}
+
+func TestBadStatusCodeWithoutApiResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("bad gateway"))
+	}))
+	defer server.Close()
+
+	client := NewHTTPAPIClientWithOptions(server.URL, HTTPAPIClientOptions{ForwardedResponse: true})
+
+	err := client.Call("order.create", newTestPayload(nil), nil)
+
+	if !ErrAPIClientBadStatusCode.IsEqual(err) {
+		t.Fatalf("expect bad status code error, got %v", err)
+	}
+}
+
+func TestCorrelationIdFromPayloadContext(t *testing.T) {
+	cases := []struct {
+		name       string
+		headerName string
+		expect     string
+	}{
+		{"default header", "", "X-Correlation-Id"},
+		{"custom header", "X-Request-Id", "X-Request-Id"},
+	}
+
+	for _, c := range cases {
+		correlationIds := make(chan string, 1)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			correlationIds <- r.Header.Get(c.expect)
+			w.Write([]byte(`{"code":0,"result":null}`))
+		}))
+
+		client := NewHTTPAPIClientWithOptions(server.URL, HTTPAPIClientOptions{CorrelationIdHeaderName: c.headerName})
+
+		payload := newTestPayload(nil)
+		payload.SetContext(CtxHttpCorrelationId, "c1")
+
+		if err := client.Call("order.get", payload, nil); err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+
+		if correlationId := <-correlationIds; correlationId != "c1" {
+			t.Errorf("%s: expect correlation id c1 in %s, got %q", c.name, c.expect, correlationId)
+		}
+
+		client.Close(context.Background())
+		server.Close()
+	}
+}
@@ -10,3 +10,35 @@ type JsonPayload struct {
 	Errors  []*spirit.Error `json:"errors"`
 	Context spirit.Map      `json:"context"`
 }
+
+// applyJsonPayload replaces the data, errors and context of payload with the
+// forwarded payload
+func applyJsonPayload(payload spirit.Payload, jsonPayload JsonPayload) (err error) {
+	if err = payload.SetData(jsonPayload.Data); err != nil {
+		return
+	}
+
+	payload.ClearErrors()
+	payload.AppendError(jsonPayload.Errors...)
+
+	names := []string{}
+	for name := range payload.Context() {
+		names = append(names, name)
+	}
+
+	for _, name := range names {
+		if _, exist := jsonPayload.Context[name]; !exist {
+			if err = payload.DeleteContext(name); err != nil {
+				return
+			}
+		}
+	}
+
+	for name, v := range jsonPayload.Context {
+		if err = payload.SetContext(name, v); err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,53 @@
+package api_client
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderForwardedKeyId     = "X-Forwarded-Key-Id"
+	HeaderForwardedTimestamp = "X-Forwarded-Timestamp"
+	HeaderForwardedNonce     = "X-Forwarded-Nonce"
+	HeaderForwardedSignature = "X-Forwarded-Signature"
+)
+
+// SignOptions is the shared key to sign the forwarded payloads, the receiver
+// verifies the signature with the key of the same key id
+type SignOptions struct {
+	KeyId string
+	Key   string
+}
+
+func (p *SignOptions) IsEnabled() bool {
+	return p.Key != ""
+}
+
+// sign sets the signature headers of body, the api name of multi call is
+// empty, each request is signed with a new nonce, so the identical calls in
+// the same second are not rejected as replays
+func (p *SignOptions) sign(header http.Header, apiName string, body []byte) {
+	if !p.IsEnabled() {
+		return
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	strNonce := hex.EncodeToString(nonce)
+
+	mac := hmac.New(sha256.New, []byte(p.Key))
+	mac.Write([]byte(apiName + "\n" + timestamp + "\n" + strNonce + "\n"))
+	mac.Write(body)
+
+	header.Set(HeaderForwardedKeyId, p.KeyId)
+	header.Set(HeaderForwardedTimestamp, timestamp)
+	header.Set(HeaderForwardedNonce, strNonce)
+	header.Set(HeaderForwardedSignature, hex.EncodeToString(mac.Sum(nil)))
+}
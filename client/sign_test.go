@@ -0,0 +1,43 @@
+package api_client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+)
+
+func TestSignWithNonce(t *testing.T) {
+	opts := SignOptions{KeyId: "k1", Key: "secret1"}
+	body := []byte(`{"id":"1"}`)
+
+	first, second := http.Header{}, http.Header{}
+	opts.sign(first, "order.get", body)
+	opts.sign(second, "order.get", body)
+
+	if first.Get(HeaderForwardedNonce) == "" || first.Get(HeaderForwardedNonce) == second.Get(HeaderForwardedNonce) {
+		t.Fatalf("expect new nonce of each request, got %q and %q", first.Get(HeaderForwardedNonce), second.Get(HeaderForwardedNonce))
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret1"))
+	mac.Write([]byte("order.get\n" + first.Get(HeaderForwardedTimestamp) + "\n" + first.Get(HeaderForwardedNonce) + "\n"))
+	mac.Write(body)
+
+	if signature := hex.EncodeToString(mac.Sum(nil)); first.Get(HeaderForwardedSignature) != signature {
+		t.Errorf("expect signature %s, got %s", signature, first.Get(HeaderForwardedSignature))
+	}
+
+	if first.Get(HeaderForwardedKeyId) != "k1" {
+		t.Errorf("expect key id k1, got %s", first.Get(HeaderForwardedKeyId))
+	}
+}
+
+func TestSignDisabled(t *testing.T) {
+	header := http.Header{}
+	(&SignOptions{}).sign(header, "order.get", nil)
+
+	if len(header) != 0 {
+		t.Errorf("expect no signature headers, got %v", header)
+	}
+}
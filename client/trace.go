@@ -0,0 +1,64 @@
+package api_client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gogap/spirit"
+)
+
+const (
+	HeaderTraceparent = "traceparent"
+	HeaderTracestate  = "tracestate"
+
+	CtxHttpTrace         = "CTX_HTTP_TRACE"
+	CtxHttpCorrelationId = "CTX_HTTP_CORRELATION_ID"
+)
+
+type traceContextKey struct{}
+
+type traceContext struct {
+	traceparent string
+	tracestate  string
+}
+
+// WithTraceContext returns the ctx carrying the w3c trace context, the calls
+// with the ctx inject the trace context instead of the one in payload context
+func WithTraceContext(ctx context.Context, traceparent, tracestate string) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, traceContext{traceparent: traceparent, tracestate: tracestate})
+}
+
+// injectTraceContext sets the trace headers from ctx, or from the payload
+// context set by the receiver while the payload was delivered
+func injectTraceContext(ctx context.Context, header http.Header, payloadContext spirit.Map) {
+	trace, ok := ctx.Value(traceContextKey{}).(traceContext)
+
+	if !ok && payloadContext != nil {
+		if v, exist := payloadContext[CtxHttpTrace].(map[string]interface{}); exist {
+			trace.traceparent, _ = v["traceparent"].(string)
+			trace.tracestate, _ = v["tracestate"].(string)
+		}
+	}
+
+	if trace.traceparent == "" {
+		return
+	}
+
+	header.Set(HeaderTraceparent, trace.traceparent)
+
+	if trace.tracestate != "" {
+		header.Set(HeaderTracestate, trace.tracestate)
+	}
+}
+
+// injectCorrelationId sets the correlation id header from the payload context
+// set by the receiver, so the downstream requests are logged with the same id
+func injectCorrelationId(header http.Header, headerName string, payloadContext spirit.Map) {
+	if payloadContext == nil {
+		return
+	}
+
+	if correlationId, ok := payloadContext[CtxHttpCorrelationId].(string); ok && correlationId != "" {
+		header.Set(headerName, correlationId)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/spirit-contrib/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/gogap/spirit"
 )
@@ -13,6 +14,8 @@ type RendererConfig struct {
 	Templates       []string            `json:"templates"`
 	Variables       []string            `json:"variables"`
 	Relation        map[string][]string `json:"relation"`
+	Reload          bool                `json:"reload"`
+	ReloadInterval  int                 `json:"reload_interval"`
 }
 
 type AccessControl struct {
@@ -56,9 +59,30 @@ func (p *AccessControl) ParseOrigin(refer string) (origin string, isAllow bool)
 }
 
 type HeaderDefines struct {
-	ApiHeader       string `json:"api"`
-	MultiCallHeader string `json:"multi_call"`
-	TimeoutHeader   string `json:"timeout"`
+	ApiHeader           string `json:"api"`
+	MultiCallHeader     string `json:"multi_call"`
+	TimeoutHeader       string `json:"timeout"`
+	IdempotencyHeader   string `json:"idempotency"`
+	CorrelationIdHeader string `json:"correlation_id"`
+}
+
+type GetRequestConfig struct {
+	Enabled bool     `json:"enabled"`
+	Apis    []string `json:"apis"`
+
+	apisMap map[string]bool
+}
+
+func (p *GetRequestConfig) initial() {
+	p.apisMap = make(map[string]bool)
+
+	for _, api := range p.Apis {
+		p.apisMap[strings.TrimSpace(api)] = true
+	}
+}
+
+func (p *GetRequestConfig) IsAllowed(apiName string) bool {
+	return p.Enabled && (p.apisMap["*"] || p.apisMap[apiName])
 }
 
 type XDomainConfig struct {
@@ -85,6 +109,8 @@ type JsonApiReceiverConfig struct {
 	DefaultLabels spirit.Labels            `json:"default_labels"`
 	ApiLabels     map[string]spirit.Labels `json:"api_labels"`
 
+	ApiSchema map[string]interface{} `json:"api_schema"`
+
 	DefaultMetadata map[string]interface{}            `json:"default_metadata"`
 	ApiMetadata     map[string]map[string]interface{} `json:"api_metadata"`
 
@@ -94,12 +120,39 @@ type JsonApiReceiverConfig struct {
 
 	ResponseHeaders map[string]string `json:"response_headers"`
 
+	StatusCode StatusCodeConfig `json:"status_code"`
+
 	Path    string `json:"path"`
 	Timeout int    `json:"timeout"`
 
+	MaxBodySize int64  `json:"max_body_size"`
+	EmptyBody   string `json:"empty_body"`
+
 	ToContext ToContext `json:"to_context"`
 
 	XDomain XDomainConfig `json:"xdomain"`
+
+	GetRequest GetRequestConfig `json:"get_request"`
+
+	Upload UploadConfig `json:"upload"`
+
+	ForwardedSign ForwardedSignConfig `json:"forwarded_sign"`
+
+	Auth AuthConfig `json:"auth"`
+
+	RateLimit RateLimitConfig `json:"rate_limit"`
+
+	Idempotency IdempotencyConfig `json:"idempotency"`
+
+	ResponseCache ResponseCacheConfig `json:"response_cache"`
+
+	Metrics MetricsConfig `json:"metrics"`
+
+	AccessLog AccessLogConfig `json:"access_log"`
+
+	Trace TraceConfig `json:"trace"`
+
+	Health HealthConfig `json:"health"`
 }
 
 func (p *JsonApiReceiverConfig) initial() {
@@ -111,6 +164,38 @@ func (p *JsonApiReceiverConfig) initial() {
 		p.Timeout = int(DefaultTimeout)
 	}
 
+	if p.Renderer.ReloadInterval <= 0 {
+		p.Renderer.ReloadInterval = int(DefaultRendererReloadInterval / time.Millisecond)
+	}
+
+	if p.MaxBodySize <= 0 {
+		p.MaxBodySize = DefaultMaxBodySize
+	}
+
+	if p.EmptyBody == "" {
+		p.EmptyBody = EmptyBodyAsObject
+	}
+
+	p.StatusCode.initial()
+
+	p.GetRequest.initial()
+
+	p.Upload.initial()
+
+	p.ForwardedSign.initial()
+
+	p.RateLimit.initial()
+
+	p.Idempotency.initial()
+
+	p.ResponseCache.initial()
+
+	p.Metrics.initial()
+
+	p.Trace.initial()
+
+	p.Health.initial()
+
 	if p.HeaderDefines.ApiHeader == "" {
 		p.HeaderDefines.ApiHeader = DefaultApiHeader
 	}
@@ -123,6 +208,14 @@ func (p *JsonApiReceiverConfig) initial() {
 		p.HeaderDefines.TimeoutHeader = DefaultApiTimeoutHeader
 	}
 
+	if p.HeaderDefines.IdempotencyHeader == "" {
+		p.HeaderDefines.IdempotencyHeader = DefaultIdempotencyHeader
+	}
+
+	if p.HeaderDefines.CorrelationIdHeader == "" {
+		p.HeaderDefines.CorrelationIdHeader = DefaultCorrelationIdHeader
+	}
+
 	distinctCache := map[string]string{}
 
 	for _, header := range internalAllowHeaders {
@@ -138,6 +231,8 @@ func (p *JsonApiReceiverConfig) initial() {
 	distinctCache[strings.ToLower(p.HeaderDefines.ApiHeader)] = p.HeaderDefines.ApiHeader
 	distinctCache[strings.ToLower(p.HeaderDefines.MultiCallHeader)] = p.HeaderDefines.MultiCallHeader
 	distinctCache[strings.ToLower(p.HeaderDefines.TimeoutHeader)] = p.HeaderDefines.TimeoutHeader
+	distinctCache[strings.ToLower(p.HeaderDefines.IdempotencyHeader)] = p.HeaderDefines.IdempotencyHeader
+	distinctCache[strings.ToLower(p.HeaderDefines.CorrelationIdHeader)] = p.HeaderDefines.CorrelationIdHeader
 
 	allowHeaders := []string{}
 
@@ -149,3 +244,53 @@ func (p *JsonApiReceiverConfig) initial() {
 
 	p.AccessControl.initial()
 }
+
+// apiNames returns the api names declared in config, the wildcard is not an
+// api
+func (p *JsonApiReceiverConfig) apiNames() (apiNames map[string]bool) {
+	apiNames = map[string]bool{}
+
+	for api := range p.ApiURN {
+		apiNames[api] = true
+	}
+
+	for api := range p.ApiSchema {
+		apiNames[api] = true
+	}
+
+	for api := range p.ApiLabels {
+		apiNames[api] = true
+	}
+
+	for api := range p.ApiMetadata {
+		apiNames[api] = true
+	}
+
+	for _, api := range p.GetRequest.Apis {
+		apiNames[api] = true
+	}
+
+	for _, api := range p.Idempotency.Apis {
+		apiNames[api] = true
+	}
+
+	for api := range p.ResponseCache.Apis {
+		apiNames[api] = true
+	}
+
+	for api := range p.RateLimit.Apis {
+		apiNames[api] = true
+	}
+
+	for api := range p.RateLimit.ClientApis {
+		apiNames[api] = true
+	}
+
+	for _, api := range p.Metrics.Apis {
+		apiNames[api] = true
+	}
+
+	delete(apiNames, "*")
+
+	return
+}
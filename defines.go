@@ -7,17 +7,41 @@ import (
 var (
 	DefaultTimeout time.Duration = 30 * time.Second
 
-	DefaultApiHeader          = "X-Api"
-	DefaultApiTimeoutHeader   = "X-Api-Call-Timeout"
-	DefaultApiMultiCallHeader = "X-Api-Multi-Call"
+	DefaultRendererReloadInterval time.Duration = 5 * time.Second
+
+	DefaultMaxBodySize int64 = 4 << 20
+
+	DefaultForwardedReplayWindow time.Duration = 5 * time.Minute
+
+	DefaultApiHeader           = "X-Api"
+	DefaultApiTimeoutHeader    = "X-Api-Call-Timeout"
+	DefaultApiMultiCallHeader  = "X-Api-Multi-Call"
+	DefaultIdempotencyHeader   = "Idempotency-Key"
+	DefaultCorrelationIdHeader = "X-Correlation-Id"
+)
+
+const (
+	EmptyBodyAsObject = "object"
+	EmptyBodyReject   = "reject"
 )
 
 const (
-	HeaderForwardedPayload = "X-Forwarded-Payload"
+	HeaderForwardedPayload   = "X-Forwarded-Payload"
+	HeaderForwardedResponse  = "X-Forwarded-Response"
+	HeaderForwardedKeyId     = "X-Forwarded-Key-Id"
+	HeaderForwardedTimestamp = "X-Forwarded-Timestamp"
+	HeaderForwardedNonce     = "X-Forwarded-Nonce"
+	HeaderForwardedSignature = "X-Forwarded-Signature"
 
 	CtxHttpCookies = "CTX_HTTP_COOKIES"
 	CtxHttpHeaders = "CTX_HTTP_HEADERS"
 	CtxHttpCustom  = "CTX_HTTP_CUSTOM"
+	CtxHttpAuth    = "CTX_HTTP_AUTH"
+
+	CtxHttpCorrelationId = "CTX_HTTP_CORRELATION_ID"
+	CtxHttpTrace         = "CTX_HTTP_TRACE"
+
+	MetadataTrace = "trace"
 )
 
 var internalAllowHeaders = []string{
@@ -27,4 +51,7 @@ var internalAllowHeaders = []string{
 	"Accept",
 	"X-Requested-With",
 	"X-Forwarded-Payload",
+	"X-Forwarded-Response",
+	"traceparent",
+	"tracestate",
 }
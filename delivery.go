@@ -4,6 +4,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/gogap/errors"
 	"github.com/gogap/spirit"
 )
 
@@ -16,6 +17,10 @@ type HttpJsonApiDelivery struct {
 	labels    spirit.Labels
 	timestamp time.Time
 
+	apiName string
+	schema  *JsonSchema
+	trace   TraceContext
+
 	labelsLocker sync.Mutex
 }
 
@@ -66,6 +71,21 @@ func (p *HttpJsonApiDelivery) Payload() spirit.Payload {
 }
 
 func (p *HttpJsonApiDelivery) Validate() (err error) {
+	if p.schema == nil {
+		return
+	}
+
+	var fields []SchemaFieldError
+	if fields, err = p.schema.Validate(p.payload.data); err != nil {
+		err = ErrApiDataValidateFailed.New(errors.Params{"apiName": p.apiName, "fields": err.Error()})
+		return
+	}
+
+	if len(fields) > 0 {
+		err = newSchemaValidationError(p.apiName, fields)
+		return
+	}
+
 	return
 }
 
@@ -13,10 +13,38 @@ var (
 )
 
 var (
-	ErrTmplVarAlreadyExist   = errors.TN(HttpJsonApiErrNamespace, 400, "template var already exist, key: {{.key}}, value: {{.value}}, original value: {{.originalValue}}")
-	ErrApiAlreadyRelatedTmpl = errors.TN(HttpJsonApiErrNamespace, 401, "api already related template, api: {{.apiName}}, template: {{.tmplName}}")
-	ErrTmplNotExit           = errors.TN(HttpJsonApiErrNamespace, 402, "template of {{.tmplName}} not exist")
-	ErrRequestTimeout        = errors.TN(HttpJsonApiErrNamespace, 408, "request timeout")
+	ErrTmplVarAlreadyExist           = errors.TN(HttpJsonApiErrNamespace, 400, "template var already exist, key: {{.key}}, value: {{.value}}, original value: {{.originalValue}}")
+	ErrApiAlreadyRelatedTmpl         = errors.TN(HttpJsonApiErrNamespace, 401, "api already related template, api: {{.apiName}}, template: {{.tmplName}}")
+	ErrTmplNotExit                   = errors.TN(HttpJsonApiErrNamespace, 402, "template of {{.tmplName}} not exist")
+	ErrLoadTemplatesFailed           = errors.TN(HttpJsonApiErrNamespace, 403, "load templates failed, paths: {{.paths}}")
+	ErrLoadVariablesFailed           = errors.TN(HttpJsonApiErrNamespace, 404, "load template variables failed, paths: {{.paths}}")
+	ErrValidateTemplateFailed        = errors.TN(HttpJsonApiErrNamespace, 405, "validate template failed, api: {{.apiName}}")
+	ErrApiNotAllowedGet              = errors.TN(HttpJsonApiErrNamespace, 406, "api of {{.apiName}} is not allowed to be called by GET request")
+	ErrGetNotSupportMultiCallForward = errors.TN(HttpJsonApiErrNamespace, 407, "GET request not support multi call or forwarded payload")
+	ErrRequestTimeout                = errors.TN(HttpJsonApiErrNamespace, 408, "request timeout")
+	ErrRequestBodyTooLarge           = errors.TN(HttpJsonApiErrNamespace, 409, "request body is larger than {{.limit}} bytes")
+	ErrParseFormDataFailed           = errors.TN(HttpJsonApiErrNamespace, 410, "parse form data of api {{.apiName}} failed")
+	ErrMalformedJsonBody             = errors.TN(HttpJsonApiErrNamespace, 411, "malformed json body, offset: {{.offset}}")
+	ErrRequestBodyIsEmpty            = errors.TN(HttpJsonApiErrNamespace, 412, "request body is empty")
+	ErrLoadApiSchemaFailed           = errors.TN(HttpJsonApiErrNamespace, 413, "load schema of api {{.apiName}} failed")
+	ErrApiDataValidateFailed         = errors.TN(HttpJsonApiErrNamespace, 414, "data of api {{.apiName}} is invalid: {{.fields}}")
+	ErrMultiCallDependencyNotExist   = errors.TN(HttpJsonApiErrNamespace, 415, "dependency {{.dependency}} of call {{.callName}} not exist")
+	ErrMultiCallDependencyCycle      = errors.TN(HttpJsonApiErrNamespace, 416, "multi call dependencies have cycle, calls: {{.callNames}}")
+	ErrMultiCallDependencyFailed     = errors.TN(HttpJsonApiErrNamespace, 417, "dependency {{.dependency}} of call {{.callName}} failed")
+	ErrMultiCallRefResolveFailed     = errors.TN(HttpJsonApiErrNamespace, 418, "resolve reference {{.ref}} of call {{.callName}} failed")
+	ErrForwardedPayloadNotSigned     = errors.TN(HttpJsonApiErrNamespace, 419, "forwarded payload is not signed")
+	ErrForwardedSignatureInvalid     = errors.TN(HttpJsonApiErrNamespace, 420, "signature of forwarded payload is invalid, reason: {{.reason}}")
+	ErrAuthRequired                  = errors.TN(HttpJsonApiErrNamespace, 421, "authentication is required by api {{.apiName}}")
+	ErrAuthFailed                    = errors.TN(HttpJsonApiErrNamespace, 422, "authentication of api {{.apiName}} failed, reason: {{.reason}}")
+	ErrLoadAuthVerifierFailed        = errors.TN(HttpJsonApiErrNamespace, 423, "load auth verifier {{.name}} failed, error: {{.err}}")
+	ErrRateLimitExceeded             = errors.TN(HttpJsonApiErrNamespace, 424, "rate limit of api {{.apiName}} exceeded")
+	ErrLoadRateLimitStoreFailed      = errors.TN(HttpJsonApiErrNamespace, 425, "load rate limit store {{.store}} failed, error: {{.err}}")
+	ErrIdempotencyKeyReused          = errors.TN(HttpJsonApiErrNamespace, 426, "idempotency key {{.key}} was used by request with different data")
+	ErrIdempotencyKeyInFlight        = errors.TN(HttpJsonApiErrNamespace, 427, "request of the idempotency key is still in flight")
+	ErrLoadIdempotencyStoreFailed    = errors.TN(HttpJsonApiErrNamespace, 428, "load idempotency store {{.store}} failed, error: {{.err}}")
+	ErrLoadResponseCacheStoreFailed  = errors.TN(HttpJsonApiErrNamespace, 429, "load response cache store {{.store}} failed, error: {{.err}}")
+	ErrLoadSpanExporterFailed        = errors.TN(HttpJsonApiErrNamespace, 430, "load span exporter {{.exporter}} failed, error: {{.err}}")
+	ErrRateLimitBatchTooLarge        = errors.TN(HttpJsonApiErrNamespace, 431, "{{.count}} calls of api {{.apiName}} exceed the rate limit burst {{.burst}}")
 
 	ErrApiGenericError            = errors.TN(HttpJsonApiErrNamespace, 500, "")
 	ErrNotSupportMultiCallForward = errors.TN(HttpJsonApiErrNamespace, 501, "not support multi call forward")
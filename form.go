@@ -0,0 +1,248 @@
+package http_json_api
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	gohttp "net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gogap/errors"
+	"github.com/gogap/spirit"
+)
+
+const (
+	UploadModeInline = "inline"
+	UploadModeSpool  = "spool"
+)
+
+var (
+	DefaultUploadMaxSize int64 = 32 << 20
+)
+
+type UploadConfig struct {
+	Mode       string           `json:"mode"`
+	TempDir    string           `json:"temp_dir"`
+	MaxSize    int64            `json:"max_size"`
+	ApiMaxSize map[string]int64 `json:"api_max_size"`
+}
+
+func (p *UploadConfig) initial() {
+	if p.Mode == "" {
+		p.Mode = UploadModeInline
+	}
+
+	if p.TempDir == "" {
+		p.TempDir = os.TempDir()
+	}
+
+	if p.MaxSize <= 0 {
+		p.MaxSize = DefaultUploadMaxSize
+	}
+}
+
+func (p *UploadConfig) maxSizeOf(apiName string) int64 {
+	if size, exist := p.ApiMaxSize[apiName]; exist && size > 0 {
+		return size
+	}
+	return p.MaxSize
+}
+
+type UploadFile struct {
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+	Path        string `json:"path,omitempty"`
+	Content     string `json:"content,omitempty"`
+}
+
+func isFormRequest(req *gohttp.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/x-www-form-urlencoded" ||
+		mediaType == "multipart/form-data"
+}
+
+// formToData converts form fields to api data the same way as query string,
+// uploaded files become UploadFile descriptors, spooled files are removed
+// once the request handled
+func (p *JsonApiReceiver) formToData(apiName string, req *gohttp.Request) (data map[string]interface{}, err error) {
+	mediaType, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		err = ErrParseFormDataFailed.New(errors.Params{"apiName": apiName}).Append(err)
+		return
+	}
+
+	maxSize := p.conf.Upload.maxSizeOf(apiName)
+	bodyReader := newLimitedReader(req.Body, maxSize)
+
+	if mediaType == "application/x-www-form-urlencoded" {
+		var body []byte
+		if body, err = ioutil.ReadAll(bodyReader); err != nil {
+			err = formReadError(apiName, bodyReader, err)
+			return
+		}
+
+		var values url.Values
+		if values, err = url.ParseQuery(string(body)); err != nil {
+			err = ErrParseFormDataFailed.New(errors.Params{"apiName": apiName}).Append(err)
+			return
+		}
+
+		data = queryToData(values)
+		return
+	}
+
+	values := url.Values{}
+	files := map[string][]UploadFile{}
+
+	reader := multipart.NewReader(bodyReader, params["boundary"])
+
+	for {
+		var part *multipart.Part
+		if part, err = reader.NextPart(); err == io.EOF {
+			err = nil
+			break
+		} else if err != nil {
+			err = formReadError(apiName, bodyReader, err)
+			return
+		}
+
+		fieldName := part.FormName()
+		if fieldName == "" {
+			part.Close()
+			continue
+		}
+
+		if part.FileName() == "" {
+			var value []byte
+			if value, err = ioutil.ReadAll(part); err != nil {
+				part.Close()
+				err = formReadError(apiName, bodyReader, err)
+				return
+			}
+			values.Add(fieldName, string(value))
+		} else {
+			var file UploadFile
+			if file, err = p.readUploadFile(part, req); err != nil {
+				part.Close()
+				err = formReadError(apiName, bodyReader, err)
+				return
+			}
+			files[fieldName] = append(files[fieldName], file)
+		}
+
+		part.Close()
+	}
+
+	// the multipart reader ignores the read error once the final boundary is
+	// buffered
+	if bodyReader.Exceeded() {
+		err = ErrRequestBodyTooLarge.New(errors.Params{"limit": bodyReader.limit})
+		return
+	}
+
+	data = queryToData(values)
+
+	for fieldName, fieldFiles := range files {
+		if strings.HasSuffix(fieldName, "[]") || len(fieldFiles) > 1 {
+			data[strings.TrimSuffix(fieldName, "[]")] = fieldFiles
+		} else {
+			data[fieldName] = fieldFiles[0]
+		}
+	}
+
+	return
+}
+
+func (p *JsonApiReceiver) readUploadFile(part *multipart.Part, req *gohttp.Request) (file UploadFile, err error) {
+	file = UploadFile{
+		Name:        part.FileName(),
+		ContentType: part.Header.Get("Content-Type"),
+	}
+
+	if p.conf.Upload.Mode == UploadModeSpool {
+		var tmpFile *os.File
+		if tmpFile, err = ioutil.TempFile(p.conf.Upload.TempDir, "upload-"); err != nil {
+			return
+		}
+		defer tmpFile.Close()
+
+		if file.Size, err = io.Copy(tmpFile, part); err != nil {
+			os.Remove(tmpFile.Name())
+			return
+		}
+
+		file.Path = tmpFile.Name()
+
+		if files, ok := req.Context().Value(uploadFilesKey{}).(*uploadFiles); ok {
+			files.add(file.Path)
+		}
+
+		return
+	}
+
+	var content []byte
+	if content, err = ioutil.ReadAll(part); err != nil {
+		return
+	}
+
+	file.Size = int64(len(content))
+	file.Content = base64.StdEncoding.EncodeToString(content)
+
+	return
+}
+
+// uploadFilesKey keeps the spooled files of request in request context
+type uploadFilesKey struct{}
+
+type uploadFiles struct {
+	paths  []string
+	locker sync.Mutex
+}
+
+// withUploadFiles returns the request tracking the spooled files, the files
+// should be removed once the request handled
+func withUploadFiles(req *gohttp.Request) (*gohttp.Request, *uploadFiles) {
+	files := &uploadFiles{}
+	return req.WithContext(context.WithValue(req.Context(), uploadFilesKey{}, files)), files
+}
+
+func (p *uploadFiles) add(path string) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.paths = append(p.paths, path)
+}
+
+func (p *uploadFiles) removeAll() {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	for _, path := range p.paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			spirit.Logger().
+				WithField("event", "remove upload file").
+				WithField("path", path).
+				Errorln(err)
+		}
+	}
+
+	p.paths = nil
+}
+
+func formReadError(apiName string, reader *limitedReader, err error) error {
+	if reader.Exceeded() {
+		return ErrRequestBodyTooLarge.New(errors.Params{"limit": reader.limit})
+	}
+	return ErrParseFormDataFailed.New(errors.Params{"apiName": apiName}).Append(err)
+}
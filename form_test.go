@@ -0,0 +1,135 @@
+package http_json_api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	gohttp "net/http"
+	"os"
+	"testing"
+
+	"github.com/gogap/spirit"
+)
+
+func newMultipartRequest(t *testing.T, fields map[string]string, files map[string]string) *gohttp.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+
+	for name, content := range files {
+		part, err := writer.CreateFormFile(name, name+".txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(content))
+	}
+
+	writer.Close()
+
+	req, _ := gohttp.NewRequest("POST", "/api", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	return req
+}
+
+func newFormTestReceiver(t *testing.T, conf JsonApiReceiverConfig) *JsonApiReceiver {
+	conf.initial()
+
+	receiver := &JsonApiReceiver{name: "test", conf: conf}
+
+	var err error
+	if receiver.authVerifiers, err = newAuthVerifiers(conf.Auth); err != nil {
+		t.Fatal(err)
+	}
+
+	return receiver
+}
+
+func TestFormToDataSpool(t *testing.T) {
+	tempDir := t.TempDir()
+
+	receiver := newFormTestReceiver(t, JsonApiReceiverConfig{
+		Upload: UploadConfig{Mode: UploadModeSpool, TempDir: tempDir},
+	})
+
+	req, uploads := withUploadFiles(newMultipartRequest(t, map[string]string{"count": "2"}, map[string]string{"file": "hello"}))
+
+	data, err := receiver.formToData("file.upload", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data["count"] != int64(2) {
+		t.Errorf("expect the field coerced, got %#v", data["count"])
+	}
+
+	file, ok := data["file"].(UploadFile)
+	if !ok {
+		t.Fatalf("expect the upload file, got %#v", data["file"])
+	}
+
+	if content, e := ioutil.ReadFile(file.Path); e != nil || string(content) != "hello" || file.Size != 5 {
+		t.Fatalf("expect the spooled file, got %v, %q", e, content)
+	}
+
+	uploads.removeAll()
+
+	if _, e := os.Stat(file.Path); !os.IsNotExist(e) {
+		t.Errorf("expect the spooled file removed, got %v", e)
+	}
+}
+
+func TestFormToDataInline(t *testing.T) {
+	receiver := newFormTestReceiver(t, JsonApiReceiverConfig{})
+
+	req := newMultipartRequest(t, nil, map[string]string{"file": "hello"})
+
+	data, err := receiver.formToData("file.upload", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if file, ok := data["file"].(UploadFile); !ok || file.Content != "aGVsbG8=" || file.Path != "" {
+		t.Errorf("expect the inline file, got %#v", data["file"])
+	}
+}
+
+func TestFormToDataTooLarge(t *testing.T) {
+	receiver := newFormTestReceiver(t, JsonApiReceiverConfig{
+		Upload: UploadConfig{MaxSize: 16},
+	})
+
+	req := newMultipartRequest(t, nil, map[string]string{"file": "the content exceeds the limit"})
+
+	if _, err := receiver.formToData("file.upload", req); !ErrRequestBodyTooLarge.IsEqual(err) {
+		t.Errorf("expect body too large, got %v", err)
+	}
+}
+
+func TestFormAuthenticatedBeforeParsing(t *testing.T) {
+	tempDir := t.TempDir()
+
+	receiver := newFormTestReceiver(t, JsonApiReceiverConfig{
+		Upload: UploadConfig{Mode: UploadModeSpool, TempDir: tempDir},
+		Auth: AuthConfig{
+			Default: []string{"key"},
+			Verifiers: map[string]AuthVerifierConfig{
+				"key": {Type: AuthTypeApiKey, Options: spirit.Map{"keys": map[string]interface{}{"k1": "alice"}}},
+			},
+		},
+	})
+
+	req, uploads := withUploadFiles(newMultipartRequest(t, nil, map[string]string{"file": "hello"}))
+	req.Header.Set(receiver.conf.HeaderDefines.ApiHeader, "file.upload")
+
+	if _, _, err := receiver.toDeliveries(req); !ErrAuthRequired.IsEqual(err) {
+		t.Fatalf("expect auth required, got %v", err)
+	}
+
+	if files, _ := ioutil.ReadDir(tempDir); len(files) != 0 || len(uploads.paths) != 0 {
+		t.Errorf("expect the rejected form not parsed, got %d files", len(files))
+	}
+}
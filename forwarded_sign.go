@@ -0,0 +1,127 @@
+package http_json_api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	gohttp "net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gogap/errors"
+)
+
+// ForwardedSignConfig enables the signature verification of the forwarded
+// payloads, the keys are the shared secrets by key id, so the keys could be
+// rotated by adding the new key before the callers switch to it
+type ForwardedSignConfig struct {
+	Keys         map[string]string `json:"keys"`
+	ReplayWindow int               `json:"replay_window"` // seconds
+
+	replays *signatureReplays
+}
+
+func (p *ForwardedSignConfig) initial() {
+	if p.ReplayWindow <= 0 {
+		p.ReplayWindow = int(DefaultForwardedReplayWindow / time.Second)
+	}
+
+	p.replays = &signatureReplays{signatures: make(map[string]time.Time)}
+}
+
+func (p *ForwardedSignConfig) IsEnabled() bool {
+	return len(p.Keys) > 0
+}
+
+// Verify checks the signature of body and api name, the api name of multi
+// call is empty, the nonce of a key id could be used only once in replay window
+func (p *ForwardedSignConfig) Verify(req *gohttp.Request, apiName string, body []byte) (err error) {
+	if !p.IsEnabled() {
+		return
+	}
+
+	keyId := req.Header.Get(HeaderForwardedKeyId)
+	strTimestamp := req.Header.Get(HeaderForwardedTimestamp)
+	nonce := req.Header.Get(HeaderForwardedNonce)
+	signature := req.Header.Get(HeaderForwardedSignature)
+
+	if signature == "" || strTimestamp == "" || nonce == "" {
+		err = ErrForwardedPayloadNotSigned.New()
+		return
+	}
+
+	secret, exist := p.Keys[keyId]
+	if !exist {
+		err = ErrForwardedSignatureInvalid.New(errors.Params{"reason": "unknown key id " + keyId})
+		return
+	}
+
+	timestamp, e := strconv.ParseInt(strTimestamp, 10, 64)
+	if e != nil {
+		err = ErrForwardedSignatureInvalid.New(errors.Params{"reason": "bad timestamp"})
+		return
+	}
+
+	window := time.Duration(p.ReplayWindow) * time.Second
+	signedAt := time.Unix(timestamp, 0)
+
+	if diff := time.Now().Sub(signedAt); diff > window || diff < -window {
+		err = ErrForwardedSignatureInvalid.New(errors.Params{"reason": "timestamp out of replay window"})
+		return
+	}
+
+	expected := signForwardedPayload(secret, apiName, strTimestamp, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		err = ErrForwardedSignatureInvalid.New(errors.Params{"reason": "signature mismatch"})
+		return
+	}
+
+	if !p.replays.once(keyId+"\n"+nonce, signedAt.Add(window)) {
+		err = ErrForwardedSignatureInvalid.New(errors.Params{"reason": "replayed request"})
+		return
+	}
+
+	return
+}
+
+// signForwardedPayload is the hex of HMAC-SHA256 over api name, timestamp,
+// nonce and body joined by new line, it should be the same as the api client
+func signForwardedPayload(secret, apiName, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(apiName + "\n" + timestamp + "\n" + nonce + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signatureReplays keeps the nonces seen in replay window by key id
+type signatureReplays struct {
+	signatures map[string]time.Time
+	purgedAt   time.Time
+	locker     sync.Mutex
+}
+
+// once returns false if the nonce was seen before it expired
+func (p *signatureReplays) once(nonce string, expireAt time.Time) bool {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(p.purgedAt) > time.Second {
+		for sig, sigExpireAt := range p.signatures {
+			if now.After(sigExpireAt) {
+				delete(p.signatures, sig)
+			}
+		}
+		p.purgedAt = now
+	}
+
+	if sigExpireAt, exist := p.signatures[nonce]; exist && !now.After(sigExpireAt) {
+		return false
+	}
+
+	p.signatures[nonce] = expireAt
+
+	return true
+}
@@ -0,0 +1,64 @@
+package http_json_api
+
+import (
+	gohttp "net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newSignedRequest(keyId, secret, apiName, nonce string, signedAt time.Time, body []byte) *gohttp.Request {
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+
+	req, _ := gohttp.NewRequest("POST", "/api", nil)
+	req.Header.Set(HeaderForwardedKeyId, keyId)
+	req.Header.Set(HeaderForwardedTimestamp, timestamp)
+	req.Header.Set(HeaderForwardedNonce, nonce)
+	req.Header.Set(HeaderForwardedSignature, signForwardedPayload(secret, apiName, timestamp, nonce, body))
+
+	return req
+}
+
+func TestForwardedSignVerify(t *testing.T) {
+	body := []byte(`{"id":"1","data":{}}`)
+	now := time.Now()
+
+	cases := []struct {
+		name   string
+		req    *gohttp.Request
+		api    string
+		expect bool
+	}{
+		{"valid", newSignedRequest("k1", "secret1", "order.get", "n1", now, body), "order.get", true},
+		{"rotated key", newSignedRequest("k2", "secret2", "order.get", "n2", now, body), "order.get", true},
+		{"same second with other nonce", newSignedRequest("k1", "secret1", "order.get", "n3", now, body), "order.get", true},
+		{"replayed nonce", newSignedRequest("k1", "secret1", "order.get", "n1", now, body), "order.get", false},
+		{"same nonce of other key", newSignedRequest("k2", "secret2", "order.get", "n1", now, body), "order.get", true},
+		{"unknown key id", newSignedRequest("k3", "secret1", "order.get", "n4", now, body), "order.get", false},
+		{"wrong secret", newSignedRequest("k1", "secret2", "order.get", "n5", now, body), "order.get", false},
+		{"other api", newSignedRequest("k1", "secret1", "order.get", "n6", now, body), "order.delete", false},
+		{"expired", newSignedRequest("k1", "secret1", "order.get", "n7", now.Add(-time.Hour), body), "order.get", false},
+		{"missing nonce", newSignedRequest("k1", "secret1", "order.get", "", now, body), "order.get", false},
+	}
+
+	conf := ForwardedSignConfig{Keys: map[string]string{"k1": "secret1", "k2": "secret2"}}
+	conf.initial()
+
+	for _, c := range cases {
+		err := conf.Verify(c.req, c.api, body)
+		if (err == nil) != c.expect {
+			t.Errorf("%s: expect verified %v, got %v", c.name, c.expect, err)
+		}
+	}
+}
+
+func TestForwardedSignDisabled(t *testing.T) {
+	conf := ForwardedSignConfig{}
+	conf.initial()
+
+	req, _ := gohttp.NewRequest("POST", "/api", nil)
+
+	if err := conf.Verify(req, "order.get", nil); err != nil {
+		t.Errorf("expect unsigned request passed if disabled, got %v", err)
+	}
+}
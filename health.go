@@ -0,0 +1,264 @@
+package http_json_api
+
+import (
+	"encoding/json"
+	"fmt"
+	gohttp "net/http"
+	"runtime"
+	"sync"
+	"time"
+)
+
+var (
+	// Version is the build version reported by /info, it could be set by
+	// -ldflags "-X github.com/spirit-contrib/http_api.Version=1.0.0"
+	Version = "dev"
+
+	DefaultHealthTimeoutRatio  = 0.5
+	DefaultHealthTimeoutWindow = time.Minute
+	DefaultHealthMinDeliveries = 10
+)
+
+const (
+	HealthStatusOk   = "ok"
+	HealthStatusFail = "fail"
+
+	HealthCheckRenderer     = "renderer"
+	HealthCheckTimeoutRatio = "timeout_ratio"
+)
+
+// HealthConfig is the threshold of readiness, the receiver is not ready if
+// the ratio of timed out deliveries in window exceeds the timeout ratio, the
+// check is skipped until min deliveries dispatched in window. the /info
+// exposes the apis and urns, so it is served only if enabled
+type HealthConfig struct {
+	TimeoutRatio  float64 `json:"timeout_ratio"`
+	TimeoutWindow int     `json:"timeout_window"` // seconds
+	MinDeliveries int     `json:"min_deliveries"`
+	Info          bool    `json:"info"`
+}
+
+func (p *HealthConfig) initial() {
+	if p.TimeoutRatio <= 0 {
+		p.TimeoutRatio = DefaultHealthTimeoutRatio
+	}
+
+	if p.TimeoutWindow <= 0 {
+		p.TimeoutWindow = int(DefaultHealthTimeoutWindow / time.Second)
+	}
+
+	if p.MinDeliveries <= 0 {
+		p.MinDeliveries = DefaultHealthMinDeliveries
+	}
+}
+
+// HealthCheckFunc returns error if the check failed
+type HealthCheckFunc func() (err error)
+
+var (
+	livenessChecks     = map[string]HealthCheckFunc{}
+	readinessChecks    = map[string]HealthCheckFunc{}
+	healthChecksLocker sync.RWMutex
+)
+
+// RegisterLivenessCheck registers the check of /healthz for all receivers
+func RegisterLivenessCheck(name string, fn HealthCheckFunc) {
+	healthChecksLocker.Lock()
+	defer healthChecksLocker.Unlock()
+
+	livenessChecks[name] = fn
+}
+
+// RegisterReadinessCheck registers the check of /readyz for all receivers
+func RegisterReadinessCheck(name string, fn HealthCheckFunc) {
+	healthChecksLocker.Lock()
+	defer healthChecksLocker.Unlock()
+
+	readinessChecks[name] = fn
+}
+
+type HealthReport struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+type deliveryBucket struct {
+	second   int64
+	total    int
+	timeouts int
+}
+
+// deliveryWindow counts the dispatched and timed out deliveries in the
+// recent seconds
+type deliveryWindow struct {
+	buckets []deliveryBucket
+	locker  sync.Mutex
+}
+
+func newDeliveryWindow(seconds int) *deliveryWindow {
+	return &deliveryWindow{
+		buckets: make([]deliveryBucket, seconds),
+	}
+}
+
+func (p *deliveryWindow) Observe(total, timeouts int) {
+	if total == 0 {
+		return
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	now := time.Now().Unix()
+
+	bucket := &p.buckets[now%int64(len(p.buckets))]
+	if bucket.second != now {
+		*bucket = deliveryBucket{second: now}
+	}
+
+	bucket.total += total
+	bucket.timeouts += timeouts
+}
+
+func (p *deliveryWindow) Sum() (total, timeouts int) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	since := time.Now().Unix() - int64(len(p.buckets))
+
+	for _, bucket := range p.buckets {
+		if bucket.second > since {
+			total += bucket.total
+			timeouts += bucket.timeouts
+		}
+	}
+
+	return
+}
+
+// checkRenderer fails if the last reload failed, the old renderer keeps
+// serving until the templates are fixed
+func (p *JsonApiReceiver) checkRenderer() (err error) {
+	if _, ok := p.rendererReloader.renderer.Load().(*APIResponseRenderer); !ok {
+		err = fmt.Errorf("renderer not loaded")
+		return
+	}
+
+	if e := p.rendererReloader.LastReloadError(); e != nil {
+		err = fmt.Errorf("reload renderer failed: %s", e.Error())
+	}
+
+	return
+}
+
+func (p *JsonApiReceiver) checkTimeoutRatio() (err error) {
+	total, timeouts := p.deliveryWindow.Sum()
+
+	if total < p.conf.Health.MinDeliveries {
+		return
+	}
+
+	if ratio := float64(timeouts) / float64(total); ratio > p.conf.Health.TimeoutRatio {
+		err = fmt.Errorf("%d of %d deliveries timed out in %ds, ratio %.2f exceeds %.2f",
+			timeouts, total, p.conf.Health.TimeoutWindow, ratio, p.conf.Health.TimeoutRatio)
+	}
+
+	return
+}
+
+func (p *JsonApiReceiver) healthReport(builtins map[string]HealthCheckFunc, registered map[string]HealthCheckFunc) (report HealthReport) {
+	checks := map[string]HealthCheckFunc{}
+
+	for name, fn := range builtins {
+		checks[name] = fn
+	}
+
+	healthChecksLocker.RLock()
+	for name, fn := range registered {
+		checks[name] = fn
+	}
+	healthChecksLocker.RUnlock()
+
+	report = HealthReport{
+		Status: HealthStatusOk,
+		Checks: map[string]string{},
+	}
+
+	for name, fn := range checks {
+		if err := fn(); err != nil {
+			report.Status = HealthStatusFail
+			report.Checks[name] = err.Error()
+		} else {
+			report.Checks[name] = HealthStatusOk
+		}
+	}
+
+	return
+}
+
+func (p *JsonApiReceiver) healthzHandle(w gohttp.ResponseWriter) {
+	p.writeHealthReport(p.healthReport(nil, livenessChecks), w)
+}
+
+func (p *JsonApiReceiver) readyzHandle(w gohttp.ResponseWriter) {
+	builtins := map[string]HealthCheckFunc{
+		HealthCheckRenderer:     p.checkRenderer,
+		HealthCheckTimeoutRatio: p.checkTimeoutRatio,
+	}
+
+	p.writeHealthReport(p.healthReport(builtins, readinessChecks), w)
+}
+
+func (p *JsonApiReceiver) writeHealthReport(report HealthReport, w gohttp.ResponseWriter) {
+	statusCode := gohttp.StatusOK
+	if report.Status != HealthStatusOk {
+		statusCode = gohttp.StatusServiceUnavailable
+	}
+
+	data, _ := json.Marshal(report)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(data)
+}
+
+type ReceiverInfo struct {
+	Name      string            `json:"name"`
+	URN       string            `json:"urn"`
+	Version   string            `json:"version"`
+	GoVersion string            `json:"go_version"`
+	BindURN   string            `json:"bind_urn"`
+	Apis      map[string]string `json:"apis"`
+}
+
+// Info returns the build version and the configured apis with the urns they
+// are delivered to
+func (p *JsonApiReceiver) Info() (info ReceiverInfo) {
+	info = ReceiverInfo{
+		Name:      p.name,
+		URN:       p.URN(),
+		Version:   Version,
+		GoVersion: runtime.Version(),
+		BindURN:   p.conf.BindURN,
+		Apis:      map[string]string{},
+	}
+
+	apiNames := p.conf.apiNames()
+
+	for api := range apiNames {
+		if urn, exist := p.conf.ApiURN[api]; exist {
+			info.Apis[api] = urn
+		} else {
+			info.Apis[api] = p.conf.BindURN
+		}
+	}
+
+	return
+}
+
+func (p *JsonApiReceiver) infoHandle(w gohttp.ResponseWriter) {
+	data, _ := json.Marshal(p.Info())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
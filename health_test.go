@@ -0,0 +1,96 @@
+package http_json_api
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckRendererReloadFailed(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "resp.tmpl")
+
+	if err := ioutil.WriteFile(file, []byte(`{"code":{{.API.Response.Code}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reloader, err := NewAPIResponseRendererReloader(RendererConfig{Templates: []string{dir}, DefaultTemplate: "resp.tmpl"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receiver := &JsonApiReceiver{rendererReloader: reloader}
+
+	if err = receiver.checkRenderer(); err != nil {
+		t.Fatalf("expect the renderer ok, got %v", err)
+	}
+
+	ioutil.WriteFile(file, []byte(`{"code":{{.API.Response.Code}`), 0644)
+	reloader.reloadIfChanged()
+
+	if err = receiver.checkRenderer(); err == nil {
+		t.Fatalf("expect the failed reload reported")
+	}
+
+	ioutil.WriteFile(file, []byte(`{"code":{{.API.Response.Code}},"ok":true}`), 0644)
+	reloader.reloadIfChanged()
+
+	if err = receiver.checkRenderer(); err != nil {
+		t.Errorf("expect the renderer ok once reloaded, got %v", err)
+	}
+}
+
+func TestCheckTimeoutRatio(t *testing.T) {
+	cases := []struct {
+		name      string
+		total     int
+		timeouts  int
+		expectErr bool
+	}{
+		{"no delivery", 0, 0, false},
+		{"below min deliveries", 5, 5, false},
+		{"below ratio", 10, 5, false},
+		{"exceeds ratio", 10, 6, true},
+	}
+
+	for _, c := range cases {
+		conf := JsonApiReceiverConfig{}
+		conf.initial()
+
+		receiver := &JsonApiReceiver{conf: conf, deliveryWindow: newDeliveryWindow(conf.Health.TimeoutWindow)}
+		receiver.deliveryWindow.Observe(c.total, c.timeouts)
+
+		if err := receiver.checkTimeoutRatio(); (err != nil) != c.expectErr {
+			t.Errorf("%s: expect error %v, got %v", c.name, c.expectErr, err)
+		}
+	}
+}
+
+func TestReadyzStatusCode(t *testing.T) {
+	conf := JsonApiReceiverConfig{}
+	conf.initial()
+
+	reloader, err := NewAPIResponseRendererReloader(conf.Renderer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receiver := &JsonApiReceiver{conf: conf, rendererReloader: reloader, deliveryWindow: newDeliveryWindow(conf.Health.TimeoutWindow)}
+
+	recorder := httptest.NewRecorder()
+	receiver.readyzHandle(recorder)
+
+	if recorder.Code != 200 {
+		t.Errorf("expect ready, got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	receiver.deliveryWindow.Observe(conf.Health.MinDeliveries, conf.Health.MinDeliveries)
+
+	recorder = httptest.NewRecorder()
+	receiver.readyzHandle(recorder)
+
+	if recorder.Code != 503 {
+		t.Errorf("expect not ready, got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,342 @@
+package http_json_api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	gohttp "net/http"
+	"time"
+
+	"github.com/gogap/errors"
+	"github.com/gogap/spirit"
+)
+
+const (
+	IdempotencyStoreMemory = "memory"
+
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+)
+
+var (
+	DefaultIdempotencyTTL      = time.Hour * 24
+	DefaultIdempotencyCapacity = 10000
+
+	idempotencyPollInterval = time.Millisecond * 50
+)
+
+// IdempotencyConfig enables the idempotency key of the apis, the first
+// response of key is replayed to the duplicate requests in ttl
+type IdempotencyConfig struct {
+	Apis []string `json:"apis"`
+	TTL  int      `json:"ttl"` // seconds
+
+	Store        string     `json:"store"`
+	StoreOptions spirit.Map `json:"store_options"`
+
+	apisMap map[string]bool
+}
+
+func (p *IdempotencyConfig) initial() {
+	p.apisMap = make(map[string]bool)
+
+	for _, api := range p.Apis {
+		p.apisMap[api] = true
+	}
+
+	if p.TTL <= 0 {
+		p.TTL = int(DefaultIdempotencyTTL / time.Second)
+	}
+
+	if p.Store == "" {
+		p.Store = IdempotencyStoreMemory
+	}
+}
+
+func (p *IdempotencyConfig) IsEnabled() bool {
+	return len(p.apisMap) > 0
+}
+
+func (p *IdempotencyConfig) IsAllowed(apiName string) bool {
+	return p.apisMap["*"] || p.apisMap[apiName]
+}
+
+// IdempotencyRecord is the in flight call or the stored response of key, the
+// fingerprint is the hash of api data to detect the reused keys
+type IdempotencyRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	InFlight    bool   `json:"in_flight"`
+	StatusCode  int    `json:"status_code"`
+	Body        []byte `json:"body"`
+
+	// the error of the stored response, zero code if succeeded
+	Code           uint64 `json:"code"`
+	ErrorNamespace string `json:"error_namespace"`
+}
+
+type IdempotencyStore interface {
+	// Reserve stores the record if the key is new, otherwise it returns the
+	// existing record without change
+	Reserve(key string, record IdempotencyRecord, ttl time.Duration) (existing *IdempotencyRecord, err error)
+	Get(key string) (record *IdempotencyRecord, err error)
+	Save(key string, record IdempotencyRecord, ttl time.Duration) (err error)
+	Delete(key string) (err error)
+}
+
+type NewIdempotencyStoreFunc func(options spirit.Map) (store IdempotencyStore, err error)
+
+var idempotencyStores = map[string]NewIdempotencyStoreFunc{
+	IdempotencyStoreMemory: func(options spirit.Map) (store IdempotencyStore, err error) {
+		opts := struct {
+			Capacity int `json:"capacity"`
+		}{}
+
+		if err = options.ToObject(&opts); err != nil {
+			return
+		}
+
+		store = NewMemoryIdempotencyStore(opts.Capacity)
+
+		return
+	},
+}
+
+// RegisterIdempotencyStore registers the store could be used in idempotency config
+func RegisterIdempotencyStore(name string, fn NewIdempotencyStoreFunc) {
+	idempotencyStores[name] = fn
+}
+
+func newIdempotencyStore(conf IdempotencyConfig) (store IdempotencyStore, err error) {
+	fn, exist := idempotencyStores[conf.Store]
+	if !exist {
+		err = ErrLoadIdempotencyStoreFailed.New(errors.Params{"store": conf.Store, "err": "store not exist"})
+		return
+	}
+
+	options := conf.StoreOptions
+	if options == nil {
+		options = spirit.Map{}
+	}
+
+	if store, err = fn(options); err != nil {
+		err = ErrLoadIdempotencyStoreFailed.New(errors.Params{"store": conf.Store, "err": err})
+		return
+	}
+
+	return
+}
+
+type idempotentCall struct {
+	key         string
+	fingerprint string
+	existing    *IdempotencyRecord
+	writer      *idempotentResponseWriter
+
+	renderFailed bool
+}
+
+// beginIdempotentCall reserves the idempotency key of the single api call,
+// the call is nil if the request has no key or the api is not idempotent
+func (p *JsonApiReceiver) beginIdempotentCall(req *gohttp.Request, deliveries []spirit.Delivery) (call *idempotentCall, err error) {
+	if p.idempotencyStore == nil || req.Method != "POST" || p.isMultiCall(req) || p.isForwarded(req) || len(deliveries) != 1 {
+		return
+	}
+
+	key := req.Header.Get(p.conf.HeaderDefines.IdempotencyHeader)
+	if key == "" {
+		return
+	}
+
+	delivery, ok := deliveries[0].(*HttpJsonApiDelivery)
+	if !ok || !p.conf.Idempotency.IsAllowed(delivery.apiName) {
+		return
+	}
+
+	payload := delivery.Payload()
+
+	// the keys of different principals never collide
+	scope := ""
+	if v, exist := payload.GetContext(CtxHttpAuth); exist {
+		if principal, ok := v.(*AuthPrincipal); ok {
+			scope = principal.Verifier + ":" + principal.Principal
+		}
+	}
+
+	data, _ := payload.GetData()
+
+	var bData []byte
+	if bData, err = json.Marshal(data); err != nil {
+		return
+	}
+
+	sum := sha256.Sum256(bData)
+
+	call = &idempotentCall{
+		key:         p.name + ":" + delivery.apiName + ":" + scope + ":" + key,
+		fingerprint: hex.EncodeToString(sum[:]),
+	}
+
+	ttl := time.Duration(p.conf.Idempotency.TTL) * time.Second
+
+	if call.existing, err = p.idempotencyStore.Reserve(call.key, IdempotencyRecord{Fingerprint: call.fingerprint, InFlight: true}, ttl); err != nil {
+		spirit.Logger().
+			WithField("event", "reserve idempotency key").
+			WithField("urn", p.URN()).
+			WithField("name", p.Name()).
+			Errorln(err)
+
+		call, err = nil, nil
+		return
+	}
+
+	if call.existing != nil && call.existing.Fingerprint != call.fingerprint {
+		err = ErrIdempotencyKeyReused.New(errors.Params{"key": key})
+		return
+	}
+
+	return
+}
+
+func (p *JsonApiReceiver) recordIdempotentCall(call *idempotentCall, res gohttp.ResponseWriter) gohttp.ResponseWriter {
+	call.writer = &idempotentResponseWriter{ResponseWriter: res}
+	return call.writer
+}
+
+// finishIdempotentCall stores the rendered response including the business
+// errors, the key is released if the call timed out, failed internally or
+// the response failed to render, so it could be retried
+func (p *JsonApiReceiver) finishIdempotentCall(call *idempotentCall, apiResponse map[string]APIResponse) {
+	var err error
+
+	statusCode := call.writer.statusCode
+	if statusCode == 0 {
+		statusCode = gohttp.StatusOK
+	}
+
+	if call.renderFailed || !isApiResponseFinal(apiResponse) {
+		err = p.idempotencyStore.Delete(call.key)
+	} else {
+		record := IdempotencyRecord{
+			Fingerprint: call.fingerprint,
+			StatusCode:  statusCode,
+			Body:        call.writer.body.Bytes(),
+		}
+
+		for _, resp := range apiResponse {
+			record.Code = resp.Code
+			record.ErrorNamespace = resp.ErrorNamespace
+		}
+
+		err = p.idempotencyStore.Save(call.key, record, time.Duration(p.conf.Idempotency.TTL)*time.Second)
+	}
+
+	if err != nil {
+		spirit.Logger().
+			WithField("event", "finish idempotency key").
+			WithField("urn", p.URN()).
+			WithField("name", p.Name()).
+			Errorln(err)
+	}
+}
+
+// replayIdempotentCall writes the stored response, the duplicate of in
+// flight call waits for the response until request timeout
+func (p *JsonApiReceiver) replayIdempotentCall(call *idempotentCall, access *accessLog, res gohttp.ResponseWriter, req *gohttp.Request, done chan<- bool) {
+	defer notifyDone(done)
+
+	var err error
+	var record *IdempotencyRecord
+
+	defer func() {
+		resp := APIResponse{}
+		if err != nil {
+			resp = p.errorToApiResponse(err)
+		} else if record != nil {
+			resp = APIResponse{Code: record.Code, ErrorNamespace: record.ErrorNamespace}
+		}
+		p.observeUndispatchedResponse(access, resp)
+	}()
+
+	record = call.existing
+	deadline := time.Now().Add(p.requestTimeout(req))
+
+	for record != nil && record.InFlight && time.Now().Before(deadline) {
+		time.Sleep(idempotencyPollInterval)
+
+		if record, err = p.idempotencyStore.Get(call.key); err != nil {
+			p.writeErrorResponse(err, res, req)
+			return
+		}
+	}
+
+	if record == nil || record.InFlight {
+		err = ErrIdempotencyKeyInFlight.New()
+		p.writeErrorResponse(err, res, req)
+		return
+	}
+
+	res.Header().Set(HeaderIdempotentReplayed, "true")
+
+	p.writeResponseWithStatusCode(record.Body, res, req, record.StatusCode)
+}
+
+type idempotentResponseWriter struct {
+	gohttp.ResponseWriter
+
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (p *idempotentResponseWriter) WriteHeader(statusCode int) {
+	p.statusCode = statusCode
+	p.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (p *idempotentResponseWriter) Write(data []byte) (int, error) {
+	p.body.Write(data)
+	return p.ResponseWriter.Write(data)
+}
+
+// MemoryIdempotencyStore keeps the records in process, the least recently
+// used records are evicted once the capacity is reached
+type MemoryIdempotencyStore struct {
+	cache *lruCache
+}
+
+func NewMemoryIdempotencyStore(capacity int) *MemoryIdempotencyStore {
+	if capacity <= 0 {
+		capacity = DefaultIdempotencyCapacity
+	}
+
+	return &MemoryIdempotencyStore{
+		cache: newLRUCache(capacity),
+	}
+}
+
+func (p *MemoryIdempotencyStore) Reserve(key string, record IdempotencyRecord, ttl time.Duration) (existing *IdempotencyRecord, err error) {
+	if v, exist := p.cache.SetIfAbsent(key, record, ttl); exist {
+		existingRecord := v.(IdempotencyRecord)
+		existing = &existingRecord
+	}
+
+	return
+}
+
+func (p *MemoryIdempotencyStore) Get(key string) (record *IdempotencyRecord, err error) {
+	if v, exist := p.cache.Get(key); exist {
+		existingRecord := v.(IdempotencyRecord)
+		record = &existingRecord
+	}
+
+	return
+}
+
+func (p *MemoryIdempotencyStore) Save(key string, record IdempotencyRecord, ttl time.Duration) (err error) {
+	p.cache.Set(key, record, ttl)
+	return
+}
+
+func (p *MemoryIdempotencyStore) Delete(key string) (err error) {
+	p.cache.Delete(key)
+	return
+}
@@ -0,0 +1,135 @@
+package http_json_api
+
+import (
+	gohttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	store := NewMemoryIdempotencyStore(10)
+
+	existing, err := store.Reserve("k", IdempotencyRecord{Fingerprint: "f1", InFlight: true}, time.Minute)
+	if err != nil || existing != nil {
+		t.Fatalf("expect the new key reserved, got %v, %v", existing, err)
+	}
+
+	if existing, _ = store.Reserve("k", IdempotencyRecord{Fingerprint: "f2", InFlight: true}, time.Minute); existing == nil || existing.Fingerprint != "f1" || !existing.InFlight {
+		t.Fatalf("expect the in flight record returned, got %v", existing)
+	}
+
+	store.Save("k", IdempotencyRecord{Fingerprint: "f1", StatusCode: 200, Body: []byte("{}")}, time.Minute)
+
+	if record, _ := store.Get("k"); record == nil || record.InFlight || string(record.Body) != "{}" {
+		t.Fatalf("expect the saved record, got %v", record)
+	}
+
+	store.Delete("k")
+
+	if record, _ := store.Get("k"); record != nil {
+		t.Fatalf("expect the record deleted, got %v", record)
+	}
+
+	store.Save("expired", IdempotencyRecord{Fingerprint: "f1"}, time.Millisecond)
+	time.Sleep(time.Millisecond * 5)
+
+	if record, _ := store.Get("expired"); record != nil {
+		t.Errorf("expect the record expired, got %v", record)
+	}
+}
+
+func TestFinishIdempotentCall(t *testing.T) {
+	cases := []struct {
+		name         string
+		apiResponse  map[string]APIResponse
+		renderFailed bool
+		expectSaved  bool
+	}{
+		{"succeeded", map[string]APIResponse{"order.create": {Code: 0, Result: "ok"}}, false, true},
+		{"business error", map[string]APIResponse{"order.create": {Code: 1001, ErrorNamespace: "ORDER"}}, false, true},
+		{"timed out", map[string]APIResponse{"order.create": {Code: ErrRequestTimeout.New().Code(), ErrorNamespace: HttpJsonApiErrNamespace}}, false, false},
+		{"internal error", map[string]APIResponse{"order.create": {Code: ErrApiGenericError.New().Code(), ErrorNamespace: HttpJsonApiErrNamespace}}, false, false},
+		{"render failed", map[string]APIResponse{"order.create": {Code: 0}}, true, false},
+		{"no response", map[string]APIResponse{}, false, false},
+	}
+
+	for _, c := range cases {
+		receiver := &JsonApiReceiver{
+			conf:             JsonApiReceiverConfig{Idempotency: IdempotencyConfig{TTL: 60}},
+			idempotencyStore: NewMemoryIdempotencyStore(10),
+		}
+
+		call := &idempotentCall{key: "k", fingerprint: "f"}
+		receiver.idempotencyStore.Reserve(call.key, IdempotencyRecord{Fingerprint: call.fingerprint, InFlight: true}, time.Minute)
+
+		// the status code is always 200 with the always ok mode
+		w := receiver.recordIdempotentCall(call, httptest.NewRecorder())
+		w.WriteHeader(200)
+		w.Write([]byte(`{"code":0}`))
+
+		call.renderFailed = c.renderFailed
+
+		receiver.finishIdempotentCall(call, c.apiResponse)
+
+		record, _ := receiver.idempotencyStore.Get(call.key)
+
+		if saved := record != nil && !record.InFlight; saved != c.expectSaved {
+			t.Errorf("%s: expect saved %v, got %v", c.name, c.expectSaved, record)
+		}
+
+		if !c.expectSaved && record != nil {
+			t.Errorf("%s: expect the key released, got %v", c.name, record)
+		}
+	}
+}
+
+func TestReplayIdempotentErrorResponse(t *testing.T) {
+	conf := JsonApiReceiverConfig{
+		ApiURN:      map[string]string{"order.create": "urn:order"},
+		Idempotency: IdempotencyConfig{Apis: []string{"order.create"}},
+		Metrics:     MetricsConfig{Enabled: true},
+	}
+	conf.initial()
+
+	receiver := &JsonApiReceiver{
+		name:             "test",
+		conf:             conf,
+		idempotencyStore: NewMemoryIdempotencyStore(10),
+	}
+	receiver.metrics = newReceiverMetrics("test", conf.Metrics, conf.apiNames())
+
+	call := &idempotentCall{key: "k", fingerprint: "f"}
+	receiver.idempotencyStore.Reserve(call.key, IdempotencyRecord{Fingerprint: call.fingerprint, InFlight: true}, time.Minute)
+
+	body := `{"code":1001,"error_namespace":"ORDER","message":"out of stock","result":null}`
+
+	w := receiver.recordIdempotentCall(call, httptest.NewRecorder())
+	w.WriteHeader(500)
+	w.Write([]byte(body))
+
+	receiver.finishIdempotentCall(call, map[string]APIResponse{"order.create": {Code: 1001, ErrorNamespace: "ORDER"}})
+
+	// the retry of the same key is replayed without dispatching
+	duplicate := &idempotentCall{key: "k", fingerprint: "f"}
+	duplicate.existing, _ = receiver.idempotencyStore.Reserve(duplicate.key, IdempotencyRecord{Fingerprint: duplicate.fingerprint, InFlight: true}, time.Minute)
+
+	access := &accessLog{
+		startAt:  time.Now(),
+		callApis: map[string]string{"order.create": "order.create"},
+	}
+
+	req, _ := gohttp.NewRequest("POST", "/order.create", nil)
+	recorder := httptest.NewRecorder()
+
+	receiver.replayIdempotentCall(duplicate, access, recorder, req, make(chan bool, 1))
+
+	if recorder.Code != 500 || recorder.Body.String() != body || recorder.Header().Get(HeaderIdempotentReplayed) != "true" {
+		t.Errorf("expect the error response replayed, got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	key := metricsResponseKey{api: "order.create", code: 1001, namespace: "ORDER"}
+	if count := receiver.metrics.responses[key]; count != 1 {
+		t.Errorf("expect the replayed error observed once, got %d", count)
+	}
+}
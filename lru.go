@@ -0,0 +1,110 @@
+package http_json_api
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type lruEntry struct {
+	key      string
+	value    interface{}
+	expireAt time.Time
+}
+
+// lruCache keeps the values in ttl, the least recently used values are
+// evicted once the capacity is reached
+type lruCache struct {
+	capacity int
+	entries  map[string]*list.Element
+	lru      *list.List
+	locker   sync.Mutex
+}
+
+func newLRUCache(capacity int) *lruCache {
+	return &lruCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+func (p *lruCache) Get(key string) (value interface{}, exist bool) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	return p.get(key)
+}
+
+func (p *lruCache) Set(key string, value interface{}, ttl time.Duration) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.set(key, value, ttl)
+}
+
+// SetIfAbsent sets the value if the key not exist, otherwise it returns the
+// existing value
+func (p *lruCache) SetIfAbsent(key string, value interface{}, ttl time.Duration) (existing interface{}, exist bool) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if existing, exist = p.get(key); exist {
+		return
+	}
+
+	p.set(key, value, ttl)
+
+	return
+}
+
+func (p *lruCache) Delete(key string) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if elem, exist := p.entries[key]; exist {
+		p.lru.Remove(elem)
+		delete(p.entries, key)
+	}
+}
+
+func (p *lruCache) get(key string) (value interface{}, exist bool) {
+	elem, exist := p.entries[key]
+	if !exist {
+		return
+	}
+
+	entry := elem.Value.(*lruEntry)
+
+	if time.Now().After(entry.expireAt) {
+		p.lru.Remove(elem)
+		delete(p.entries, key)
+		return nil, false
+	}
+
+	p.lru.MoveToFront(elem)
+
+	return entry.value, true
+}
+
+func (p *lruCache) set(key string, value interface{}, ttl time.Duration) {
+	entry := &lruEntry{
+		key:      key,
+		value:    value,
+		expireAt: time.Now().Add(ttl),
+	}
+
+	if elem, exist := p.entries[key]; exist {
+		elem.Value = entry
+		p.lru.MoveToFront(elem)
+		return
+	}
+
+	p.entries[key] = p.lru.PushFront(entry)
+
+	for p.lru.Len() > p.capacity {
+		oldest := p.lru.Back()
+		p.lru.Remove(oldest)
+		delete(p.entries, oldest.Value.(*lruEntry).key)
+	}
+}
@@ -0,0 +1,307 @@
+package http_json_api
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogap/spirit"
+)
+
+var (
+	DefaultMetricsPath = "/metrics"
+
+	DefaultMetricsLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	metricsFanOutBuckets = []float64{1, 2, 4, 8, 16, 32, 64}
+)
+
+const (
+	metricsOtherApi   = "_other"
+	metricsUnknownApi = "_unknown"
+)
+
+// MetricsConfig exposes the metrics in prometheus text format, only the api
+// names declared in config or in apis are labeled by name, the others are
+// labeled as _other to bound the label cardinality
+type MetricsConfig struct {
+	Enabled bool      `json:"enabled"`
+	Path    string    `json:"path"`
+	Apis    []string  `json:"apis"`
+	Buckets []float64 `json:"buckets"` // seconds
+}
+
+func (p *MetricsConfig) initial() {
+	if p.Path == "" {
+		p.Path = DefaultMetricsPath
+	}
+
+	if len(p.Buckets) == 0 {
+		p.Buckets = DefaultMetricsLatencyBuckets
+	}
+
+	sort.Float64s(p.Buckets)
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (p *histogram) observe(v float64) {
+	for i, bucket := range p.buckets {
+		if v <= bucket {
+			p.counts[i]++
+		}
+	}
+	p.sum += v
+	p.count++
+}
+
+func (p *histogram) write(w io.Writer, name string, labels string) {
+	for i, bucket := range p.buckets {
+		fmt.Fprintf(w, "%s_bucket{%sle=\"%s\"} %d\n", name, labels, strconv.FormatFloat(bucket, 'g', -1, 64), p.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, p.count)
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, strings.TrimSuffix(labels, ","), strconv.FormatFloat(p.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, strings.TrimSuffix(labels, ","), p.count)
+}
+
+type metricsResponseKey struct {
+	api       string
+	code      uint64
+	namespace string
+}
+
+// receiverMetrics is nil if the metrics is disabled, the methods of nil
+// metrics do nothing
+type receiverMetrics struct {
+	receiver string
+	conf     MetricsConfig
+
+	apis map[string]bool
+
+	responses      map[metricsResponseKey]uint64
+	latencies      map[string]*histogram
+	fanOut         *histogram
+	inflight       int64
+	orphaned       uint64
+	renderFailures uint64
+
+	locker sync.Mutex
+}
+
+func newReceiverMetrics(receiver string, conf MetricsConfig, apis map[string]bool) *receiverMetrics {
+	if !conf.Enabled {
+		return nil
+	}
+
+	return &receiverMetrics{
+		receiver:  receiver,
+		conf:      conf,
+		apis:      apis,
+		responses: make(map[metricsResponseKey]uint64),
+		latencies: make(map[string]*histogram),
+		fanOut:    newHistogram(metricsFanOutBuckets),
+	}
+}
+
+func (p *receiverMetrics) apiLabel(api string) string {
+	if api == "" {
+		return metricsUnknownApi
+	}
+
+	if p.apis[api] {
+		return api
+	}
+
+	return metricsOtherApi
+}
+
+func (p *receiverMetrics) ObserveResponse(api string, resp APIResponse, duration time.Duration) {
+	if p == nil {
+		return
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	api = p.apiLabel(api)
+
+	p.responses[metricsResponseKey{api: api, code: resp.Code, namespace: resp.ErrorNamespace}]++
+
+	latency, exist := p.latencies[api]
+	if !exist {
+		latency = newHistogram(p.conf.Buckets)
+		p.latencies[api] = latency
+	}
+
+	latency.observe(duration.Seconds())
+}
+
+func (p *receiverMetrics) ObserveResponses(responses map[string]APIResponse, apis map[string]string, duration time.Duration) {
+	if p == nil {
+		return
+	}
+
+	for callName, resp := range responses {
+		api := callName
+		if callApi, exist := apis[callName]; exist {
+			api = callApi
+		}
+		p.ObserveResponse(api, resp, duration)
+	}
+}
+
+func (p *receiverMetrics) ObserveMultiCall(size int) {
+	if p == nil {
+		return
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.fanOut.observe(float64(size))
+}
+
+func (p *receiverMetrics) AddInflight(n int) {
+	if p == nil {
+		return
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.inflight += int64(n)
+}
+
+func (p *receiverMetrics) IncOrphaned() {
+	if p == nil {
+		return
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.orphaned++
+}
+
+func (p *receiverMetrics) IncRenderFailures() {
+	if p == nil {
+		return
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.renderFailures++
+}
+
+// Write writes the metrics in prometheus text exposition format
+func (p *receiverMetrics) Write(w io.Writer) {
+	if p == nil {
+		return
+	}
+
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	receiver := "receiver=\"" + escapeMetricsLabel(p.receiver) + "\","
+
+	keys := []metricsResponseKey{}
+	for key := range p.responses {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].api != keys[j].api {
+			return keys[i].api < keys[j].api
+		}
+		if keys[i].namespace != keys[j].namespace {
+			return keys[i].namespace < keys[j].namespace
+		}
+		return keys[i].code < keys[j].code
+	})
+
+	fmt.Fprintln(w, "# HELP json_api_responses_total The api responses by api name and error code.")
+	fmt.Fprintln(w, "# TYPE json_api_responses_total counter")
+	for _, key := range keys {
+		fmt.Fprintf(w, "json_api_responses_total{%sapi=\"%s\",namespace=\"%s\",code=\"%d\"} %d\n",
+			receiver, escapeMetricsLabel(key.api), escapeMetricsLabel(key.namespace), key.code, p.responses[key])
+	}
+
+	apis := []string{}
+	for api := range p.latencies {
+		apis = append(apis, api)
+	}
+	sort.Strings(apis)
+
+	fmt.Fprintln(w, "# HELP json_api_response_duration_seconds The latency of api responses.")
+	fmt.Fprintln(w, "# TYPE json_api_response_duration_seconds histogram")
+	for _, api := range apis {
+		p.latencies[api].write(w, "json_api_response_duration_seconds", receiver+"api=\""+escapeMetricsLabel(api)+"\",")
+	}
+
+	fmt.Fprintln(w, "# HELP json_api_multi_call_size The number of calls in multi call requests.")
+	fmt.Fprintln(w, "# TYPE json_api_multi_call_size histogram")
+	p.fanOut.write(w, "json_api_multi_call_size", receiver)
+
+	fmt.Fprintln(w, "# HELP json_api_inflight_deliveries The deliveries waiting for response.")
+	fmt.Fprintln(w, "# TYPE json_api_inflight_deliveries gauge")
+	fmt.Fprintf(w, "json_api_inflight_deliveries{%s} %d\n", strings.TrimSuffix(receiver, ","), p.inflight)
+
+	fmt.Fprintln(w, "# HELP json_api_orphaned_deliveries_total The deliveries responded without request.")
+	fmt.Fprintln(w, "# TYPE json_api_orphaned_deliveries_total counter")
+	fmt.Fprintf(w, "json_api_orphaned_deliveries_total{%s} %d\n", strings.TrimSuffix(receiver, ","), p.orphaned)
+
+	fmt.Fprintln(w, "# HELP json_api_render_failures_total The failures of rendering api responses.")
+	fmt.Fprintln(w, "# TYPE json_api_render_failures_total counter")
+	fmt.Fprintf(w, "json_api_render_failures_total{%s} %d\n", strings.TrimSuffix(receiver, ","), p.renderFailures)
+}
+
+// observeUndispatchedResponse records the response of the calls served
+// without dispatching, like the cache hits and idempotent replays
+func (p *JsonApiReceiver) observeUndispatchedResponse(access *accessLog, resp APIResponse) {
+	responses := map[string]APIResponse{}
+	for callName := range access.callApis {
+		responses[callName] = resp
+	}
+
+	access.responses = responses
+
+	p.metrics.ObserveResponses(responses, access.callApis, time.Since(access.startAt))
+}
+
+// deliveryApiNames returns the api names of the calls, the key of api ids is
+// the delivery id and the value is the call name
+func deliveryApiNames(deliveries []spirit.Delivery, apiIds map[string]string) (callApis map[string]string) {
+	callApis = map[string]string{}
+
+	for _, delivery := range deliveries {
+		if jsonApiDelivery, ok := delivery.(*HttpJsonApiDelivery); ok {
+			callApis[apiIds[delivery.Id()]] = jsonApiDelivery.apiName
+		}
+	}
+
+	return
+}
+
+func escapeMetricsLabel(v string) string {
+	v = strings.Replace(v, `\`, `\\`, -1)
+	v = strings.Replace(v, `"`, `\"`, -1)
+	v = strings.Replace(v, "\n", `\n`, -1)
+	return v
+}
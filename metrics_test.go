@@ -0,0 +1,74 @@
+package http_json_api
+
+import (
+	gohttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReceiverMetricsApiLabel(t *testing.T) {
+	conf := JsonApiReceiverConfig{
+		ApiURN:  map[string]string{"order.get": "urn:order", "*": "urn:any"},
+		Metrics: MetricsConfig{Enabled: true, Apis: []string{"user.get"}},
+	}
+	conf.initial()
+
+	metrics := newReceiverMetrics("test", conf.Metrics, conf.apiNames())
+
+	cases := []struct {
+		api    string
+		expect string
+	}{
+		{"order.get", "order.get"},
+		{"user.get", "user.get"},
+		{"random.api.1", metricsOtherApi},
+		{"*", metricsOtherApi},
+		{"", metricsUnknownApi},
+	}
+
+	for _, c := range cases {
+		if label := metrics.apiLabel(c.api); label != c.expect {
+			t.Errorf("%q: expect label %q, got %q", c.api, c.expect, label)
+		}
+	}
+}
+
+func TestObserveUndispatchedResponse(t *testing.T) {
+	conf := JsonApiReceiverConfig{
+		ApiURN:  map[string]string{"order.get": "urn:order"},
+		Metrics: MetricsConfig{Enabled: true},
+	}
+	conf.initial()
+
+	receiver := &JsonApiReceiver{name: "test", conf: conf}
+	receiver.metrics = newReceiverMetrics("test", conf.Metrics, conf.apiNames())
+
+	access := &accessLog{
+		startAt:  time.Now(),
+		callApis: map[string]string{"order": "order.get"},
+	}
+
+	call := &cachedCall{
+		rule:  ResponseCacheRule{TTL: 60},
+		entry: &ResponseCacheEntry{ETag: `"a"`, StatusCode: 200, Body: []byte(`{"code":0}`), ExpireAt: time.Now().Add(time.Minute)},
+	}
+
+	req, _ := gohttp.NewRequest("GET", "/order.get", nil)
+	done := make(chan bool, 1)
+
+	receiver.writeCachedResponse(call, access, httptest.NewRecorder(), req, done)
+
+	if resp, exist := access.responses["order"]; !exist || resp.Code != 0 {
+		t.Errorf("expect the cache hit logged, got %v", access.responses)
+	}
+
+	key := metricsResponseKey{api: "order.get"}
+	if count := receiver.metrics.responses[key]; count != 1 {
+		t.Errorf("expect the cache hit observed once, got %d", count)
+	}
+
+	if latency := receiver.metrics.latencies["order.get"]; latency == nil || latency.count != 1 {
+		t.Errorf("expect the latency of cache hit observed, got %v", latency)
+	}
+}
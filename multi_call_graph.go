@@ -0,0 +1,498 @@
+package http_json_api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	gohttp "net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gogap/errors"
+)
+
+const (
+	multiCallApiKey     = "$api"
+	multiCallDataKey    = "$data"
+	multiCallDependsKey = "$depends"
+	multiCallRefKey     = "$ref"
+)
+
+// multiCall is an entry of multi call body, it could be declared as
+// {"$api": "order.create", "$data": {...}, "$depends": ["other"]} to call an
+// api with another name, the data of declared entry could reference the
+// result of sibling calls by {"$ref": "createOrder.result.id"}, the refs to
+// other names are kept as data, such as the $ref of json schema
+type multiCall struct {
+	name    string
+	api     string
+	data    interface{}
+	depends []string
+}
+
+// forwardedMultiCall is the forwarded multi call entry declared as call,
+// {"$api": "order.create", "$data": {"id": "...", "data": {...}, ...}}
+type forwardedMultiCall struct {
+	Api  string      `json:"$api"`
+	Data JsonPayload `json:"$data"`
+}
+
+type multiCallGraph struct {
+	calls  map[string]*multiCall
+	layers [][]string
+
+	principals map[string]*AuthPrincipal
+}
+
+func parseMultiCall(name string, v interface{}) (call multiCall, isCall bool) {
+	call = multiCall{name: name, api: name, data: v}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	api, ok := m[multiCallApiKey].(string)
+	if !ok {
+		return
+	}
+
+	call.api = api
+	call.data = m[multiCallDataKey]
+
+	if depends, ok := m[multiCallDependsKey].([]interface{}); ok {
+		for _, depend := range depends {
+			if strDepend, ok := depend.(string); ok {
+				call.depends = append(call.depends, strDepend)
+			}
+		}
+	}
+
+	isCall = true
+
+	return
+}
+
+func (p *multiCall) dependsOn(callName string) bool {
+	for _, depend := range p.depends {
+		if depend == callName {
+			return true
+		}
+	}
+	return false
+}
+
+func parseMultiCallRef(v interface{}) (ref string, isRef bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return
+	}
+
+	ref, isRef = m[multiCallRefKey].(string)
+
+	return
+}
+
+// collectMultiCallRefs collects the refs to the calls of siblings
+func collectMultiCallRefs(v interface{}, siblings map[string]bool, refs map[string]bool) {
+	if ref, isRef := parseMultiCallRef(v); isRef {
+		if callName := multiCallRefName(ref); siblings[callName] {
+			refs[callName] = true
+		}
+		return
+	}
+
+	switch d := v.(type) {
+	case map[string]interface{}:
+		for _, item := range d {
+			collectMultiCallRefs(item, siblings, refs)
+		}
+	case []interface{}:
+		for _, item := range d {
+			collectMultiCallRefs(item, siblings, refs)
+		}
+	}
+}
+
+func multiCallRefName(ref string) string {
+	return strings.SplitN(ref, ".", 2)[0]
+}
+
+// newMultiCallGraph returns nil graph if none of the calls has dependency
+func newMultiCallGraph(apiDatas map[string]interface{}) (graph *multiCallGraph, err error) {
+	calls := map[string]*multiCall{}
+	hasDependency := false
+
+	for name, apiData := range apiDatas {
+		call, isCall := parseMultiCall(name, apiData)
+
+		refs := map[string]bool{}
+		for _, depend := range call.depends {
+			refs[depend] = true
+		}
+
+		// only the data of declared entries could reference the siblings
+		if isCall {
+			siblings := map[string]bool{}
+			for sibling := range apiDatas {
+				siblings[sibling] = sibling != name
+			}
+			collectMultiCallRefs(call.data, siblings, refs)
+		}
+
+		call.depends = nil
+		for depend := range refs {
+			if _, exist := apiDatas[depend]; !exist || depend == name {
+				err = ErrMultiCallDependencyNotExist.New(errors.Params{"callName": name, "dependency": depend})
+				return
+			}
+			call.depends = append(call.depends, depend)
+		}
+		sort.Strings(call.depends)
+
+		if len(call.depends) > 0 {
+			hasDependency = true
+		}
+
+		calls[name] = &call
+	}
+
+	if !hasDependency {
+		return
+	}
+
+	// split the calls into layers, each layer only depends on the previous layers
+	resolved := map[string]bool{}
+	layers := [][]string{}
+
+	for len(resolved) < len(calls) {
+		layer := []string{}
+
+		for name, call := range calls {
+			if resolved[name] {
+				continue
+			}
+
+			ready := true
+			for _, depend := range call.depends {
+				if !resolved[depend] {
+					ready = false
+					break
+				}
+			}
+
+			if ready {
+				layer = append(layer, name)
+			}
+		}
+
+		if len(layer) == 0 {
+			unresolved := []string{}
+			for name := range calls {
+				if !resolved[name] {
+					unresolved = append(unresolved, name)
+				}
+			}
+			sort.Strings(unresolved)
+
+			err = ErrMultiCallDependencyCycle.New(errors.Params{"callNames": strings.Join(unresolved, ",")})
+			return
+		}
+
+		sort.Strings(layer)
+
+		for _, name := range layer {
+			resolved[name] = true
+		}
+
+		layers = append(layers, layer)
+	}
+
+	graph = &multiCallGraph{
+		calls:  calls,
+		layers: layers,
+	}
+
+	return
+}
+
+// resolveMultiCallRefs replaces the refs to the dependencies of call with the
+// results, the other refs are kept as they are
+func resolveMultiCallRefs(call *multiCall, v interface{}, responses map[string]APIResponse) (resolved interface{}, err error) {
+	if ref, isRef := parseMultiCallRef(v); isRef && call.dependsOn(multiCallRefName(ref)) {
+		return lookupMultiCallRef(call.name, ref, responses)
+	}
+
+	switch d := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(d))
+		for key, item := range d {
+			if m[key], err = resolveMultiCallRefs(call, item, responses); err != nil {
+				return
+			}
+		}
+		resolved = m
+	case []interface{}:
+		arr := make([]interface{}, len(d))
+		for i, item := range d {
+			if arr[i], err = resolveMultiCallRefs(call, item, responses); err != nil {
+				return
+			}
+		}
+		resolved = arr
+	default:
+		resolved = v
+	}
+
+	return
+}
+
+func lookupMultiCallRef(callName, ref string, responses map[string]APIResponse) (v interface{}, err error) {
+	segments := strings.Split(ref, ".")
+
+	resp := responses[segments[0]]
+
+	v = map[string]interface{}{
+		"code":    resp.Code,
+		"message": resp.Message,
+		"result":  resp.Result,
+	}
+
+	for _, segment := range segments[1:] {
+		found := false
+
+		switch d := v.(type) {
+		case map[string]interface{}:
+			v, found = d[segment]
+		case []interface{}:
+			if i, e := strconv.Atoi(segment); e == nil && i >= 0 && i < len(d) {
+				v, found = d[i], true
+			}
+		}
+
+		if !found {
+			err = ErrMultiCallRefResolveFailed.New(errors.Params{"callName": callName, "ref": ref})
+			return
+		}
+	}
+
+	return
+}
+
+// toMultiCallGraph reads the multi call body, if the calls have no
+// dependency, the body is restored for toDeliveries
+func (p *JsonApiReceiver) toMultiCallGraph(req *gohttp.Request) (graph *multiCallGraph, err error) {
+	var body []byte
+	if body, err = p.readJsonBody(req); err != nil {
+		return
+	}
+
+	apiDatas := map[string]interface{}{}
+	if err = decodeJsonBody(body, &apiDatas); err != nil {
+		return
+	}
+
+	if graph, err = newMultiCallGraph(apiDatas); err != nil {
+		return
+	}
+
+	if graph == nil {
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return
+	}
+
+	// the calls are authenticated and counted here once, the layer requests
+	// have no signature of their bodies
+	apiNames := []string{}
+	for _, call := range graph.calls {
+		apiNames = append(apiNames, call.api)
+	}
+
+	if graph.principals, err = p.authenticate(req, apiNames, body); err != nil {
+		graph = nil
+		return
+	}
+
+	if err = p.rateLimit(req, apiNames, graph.principals); err != nil {
+		graph = nil
+		return
+	}
+
+	return
+}
+
+// serveMultiCallGraph dispatches each layer of the graph as an internal multi
+// call request once the results of the previous layers arrived
+func (p *JsonApiReceiver) serveMultiCallGraph(graph *multiCallGraph, access *accessLog, res gohttp.ResponseWriter, req *gohttp.Request, done chan<- bool) {
+	defer notifyDone(done)
+
+	startAt := time.Now()
+	deadline := startAt.Add(p.requestTimeout(req))
+
+	responses := map[string]APIResponse{}
+
+	for _, layer := range graph.layers {
+		layerDatas := map[string]interface{}{}
+
+		for _, name := range layer {
+			call := graph.calls[name]
+
+			failedDepend := ""
+			for _, depend := range call.depends {
+				if responses[depend].Code != 0 {
+					failedDepend = depend
+					break
+				}
+			}
+
+			if failedDepend != "" {
+				responses[name] = p.errorToApiResponse(ErrMultiCallDependencyFailed.New(errors.Params{"callName": name, "dependency": failedDepend}))
+				continue
+			}
+
+			data, e := resolveMultiCallRefs(call, call.data, responses)
+			if e != nil {
+				responses[name] = p.errorToApiResponse(e)
+				continue
+			}
+
+			layerDatas[name] = map[string]interface{}{
+				multiCallApiKey:  call.api,
+				multiCallDataKey: data,
+			}
+		}
+
+		if len(layerDatas) == 0 {
+			continue
+		}
+
+		var layerResponses map[string]APIResponse
+
+		if timeout := deadline.Sub(time.Now()); timeout > 0 {
+			layerResponses = p.callMultiCallLayer(layerDatas, timeout, graph.principals, req)
+		}
+
+		for name := range layerDatas {
+			if resp, exist := layerResponses[name]; exist {
+				responses[name] = resp
+			} else {
+				responses[name] = p.errorToApiResponse(ErrRequestTimeout.New())
+			}
+		}
+	}
+
+	callApis := map[string]string{}
+	for name, call := range graph.calls {
+		callApis[name] = call.api
+	}
+
+	access.callApis = callApis
+	access.responses = responses
+
+	p.metrics.ObserveMultiCall(len(graph.calls))
+	p.metrics.ObserveResponses(responses, callApis, time.Since(startAt))
+
+	p.renderAndWriteResponse(true, responses, res, req)
+}
+
+func (p *JsonApiReceiver) callMultiCallLayer(layerDatas map[string]interface{}, timeout time.Duration, principals map[string]*AuthPrincipal, req *gohttp.Request) (responses map[string]APIResponse) {
+	responses = map[string]APIResponse{}
+
+	errorResponsesFunc := func(err error) map[string]APIResponse {
+		errResponses := map[string]APIResponse{}
+		for name := range layerDatas {
+			errResponses[name] = p.errorToApiResponse(err)
+		}
+		return errResponses
+	}
+
+	data, err := json.Marshal(layerDatas)
+	if err != nil {
+		return errorResponsesFunc(err)
+	}
+
+	layerReq, err := gohttp.NewRequest("POST", req.URL.String(), bytes.NewReader(data))
+	if err != nil {
+		return errorResponsesFunc(err)
+	}
+
+	for key, values := range req.Header {
+		layerReq.Header[key] = append([]string(nil), values...)
+	}
+
+	layerReq = layerReq.WithContext(context.WithValue(req.Context(), multiCallLayerKey{}, principals))
+
+	layerReq.Host = req.Host
+	layerReq.RemoteAddr = req.RemoteAddr
+	layerReq.Header.Set("Content-Type", "application/json")
+	layerReq.Header.Set(p.conf.HeaderDefines.MultiCallHeader, "on")
+	layerReq.Header.Set(p.conf.HeaderDefines.TimeoutHeader, strconv.FormatInt(int64(timeout/time.Millisecond), 10))
+
+	recorder := newResponseRecorder()
+	p.HTTPReceiver.Handler(recorder, layerReq)
+
+	if err = json.Unmarshal(recorder.body.Bytes(), &responses); err != nil {
+		// the whole layer was rejected before dispatching
+		errResp := APIResponse{}
+		if e := json.Unmarshal(recorder.body.Bytes(), &errResp); e == nil && errResp.Code != 0 {
+			responses = map[string]APIResponse{}
+			for name := range layerDatas {
+				responses[name] = errResp
+			}
+			return
+		}
+
+		return errorResponsesFunc(err)
+	}
+
+	return
+}
+
+// writeMultiCallLayerResponse writes the raw api responses of a layer
+// without rendering, they are rendered once all the layers finished
+func (p *JsonApiReceiver) writeMultiCallLayerResponse(apiResponse map[string]APIResponse, res gohttp.ResponseWriter, req *gohttp.Request) {
+	data, err := json.Marshal(apiResponse)
+	if err != nil {
+		p.writeErrorResponse(err, res, req)
+		return
+	}
+
+	p.writeResponse(data, res, req)
+}
+
+// multiCallLayerKey marks the internal layer requests in request context, the
+// value is the principals authenticated before dispatching the layers
+type multiCallLayerKey struct{}
+
+func multiCallLayerPrincipals(req *gohttp.Request) (principals map[string]*AuthPrincipal, isLayer bool) {
+	principals, isLayer = req.Context().Value(multiCallLayerKey{}).(map[string]*AuthPrincipal)
+	return
+}
+
+type responseRecorder struct {
+	header     gohttp.Header
+	body       bytes.Buffer
+	statusCode int
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{
+		header:     make(gohttp.Header),
+		statusCode: gohttp.StatusOK,
+	}
+}
+
+func (p *responseRecorder) Header() gohttp.Header {
+	return p.header
+}
+
+func (p *responseRecorder) Write(data []byte) (int, error) {
+	return p.body.Write(data)
+}
+
+func (p *responseRecorder) WriteHeader(statusCode int) {
+	p.statusCode = statusCode
+}
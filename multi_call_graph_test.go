@@ -0,0 +1,151 @@
+package http_json_api
+
+import (
+	"context"
+	gohttp "net/http"
+	"reflect"
+	"testing"
+)
+
+func TestIsMultiCallLayer(t *testing.T) {
+	conf := JsonApiReceiverConfig{}
+	conf.initial()
+
+	receiver := &JsonApiReceiver{conf: conf}
+
+	req, _ := gohttp.NewRequest("POST", "/api", nil)
+	req.Header.Set(conf.HeaderDefines.MultiCallHeader, "on")
+	req.Header.Set("X-Api-Multi-Call-Layer", "on")
+
+	if receiver.isMultiCallLayer(req) {
+		t.Errorf("expect the layer marker could not be set by header")
+	}
+
+	layerReq := req.WithContext(context.WithValue(req.Context(), multiCallLayerKey{}, map[string]*AuthPrincipal{}))
+
+	if !receiver.isMultiCallLayer(layerReq) {
+		t.Errorf("expect the layer marked in context")
+	}
+}
+
+func TestNewMultiCallGraph(t *testing.T) {
+	ref := func(ref string) map[string]interface{} {
+		return map[string]interface{}{"$ref": ref}
+	}
+
+	call := func(api string, data interface{}, depends ...interface{}) map[string]interface{} {
+		m := map[string]interface{}{"$api": api, "$data": data}
+		if len(depends) > 0 {
+			m["$depends"] = depends
+		}
+		return m
+	}
+
+	cases := []struct {
+		name      string
+		apiDatas  map[string]interface{}
+		expectErr bool
+		layers    [][]string
+	}{
+		{
+			name:     "no dependency",
+			apiDatas: map[string]interface{}{"a": map[string]interface{}{"id": 1}, "b": call("order.get", nil)},
+		},
+		{
+			name:     "json schema ref in plain data",
+			apiDatas: map[string]interface{}{"schema.save": map[string]interface{}{"items": ref("#/definitions/item")}, "a": nil},
+		},
+		{
+			name:     "ref of sibling in plain data",
+			apiDatas: map[string]interface{}{"a": map[string]interface{}{"id": ref("b.result.id")}, "b": nil},
+		},
+		{
+			name:     "json schema ref in declared data",
+			apiDatas: map[string]interface{}{"save": call("schema.save", map[string]interface{}{"items": ref("#/definitions/item")})},
+		},
+		{
+			name: "ref of sibling in declared data",
+			apiDatas: map[string]interface{}{
+				"create": call("order.create", map[string]interface{}{"sku": "a"}),
+				"pay":    call("order.pay", map[string]interface{}{"id": ref("create.result.id")}),
+				"notify": call("order.notify", []interface{}{ref("pay.result")}),
+			},
+			layers: [][]string{{"create"}, {"pay"}, {"notify"}},
+		},
+		{
+			name: "declared depends",
+			apiDatas: map[string]interface{}{
+				"a": call("order.create", nil),
+				"b": call("order.get", nil, "a"),
+				"c": call("order.list", nil),
+			},
+			layers: [][]string{{"a", "c"}, {"b"}},
+		},
+		{
+			name:      "depends not exist",
+			apiDatas:  map[string]interface{}{"a": call("order.get", nil, "x")},
+			expectErr: true,
+		},
+		{
+			name: "cycle",
+			apiDatas: map[string]interface{}{
+				"a": call("order.get", ref("b.result")),
+				"b": call("order.get", ref("a.result")),
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		graph, err := newMultiCallGraph(c.apiDatas)
+
+		if (err != nil) != c.expectErr {
+			t.Errorf("%s: expect error %v, got %v", c.name, c.expectErr, err)
+			continue
+		}
+
+		if c.layers == nil {
+			if graph != nil {
+				t.Errorf("%s: expect no graph, got layers %v", c.name, graph.layers)
+			}
+			continue
+		}
+
+		if graph == nil || !reflect.DeepEqual(graph.layers, c.layers) {
+			t.Errorf("%s: expect layers %v, got %v", c.name, c.layers, graph)
+		}
+	}
+}
+
+func TestResolveMultiCallRefs(t *testing.T) {
+	call := &multiCall{name: "pay", depends: []string{"create"}}
+
+	data := map[string]interface{}{
+		"id":     map[string]interface{}{"$ref": "create.result.id"},
+		"items":  []interface{}{map[string]interface{}{"$ref": "create.result.items.1"}},
+		"schema": map[string]interface{}{"$ref": "#/definitions/item"},
+	}
+
+	responses := map[string]APIResponse{
+		"create": {Result: map[string]interface{}{"id": "o1", "items": []interface{}{"a", "b"}}},
+	}
+
+	resolved, err := resolveMultiCallRefs(call, data, responses)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]interface{}{
+		"id":     "o1",
+		"items":  []interface{}{"b"},
+		"schema": map[string]interface{}{"$ref": "#/definitions/item"},
+	}
+
+	if !reflect.DeepEqual(resolved, expect) {
+		t.Errorf("expect %v, got %v", expect, resolved)
+	}
+
+	if _, err = resolveMultiCallRefs(call, map[string]interface{}{"$ref": "create.result.missing"}, responses); err == nil {
+		t.Errorf("expect the missing ref failed")
+	}
+}
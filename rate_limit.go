@@ -0,0 +1,356 @@
+package http_json_api
+
+import (
+	"math"
+	"net"
+	gohttp "net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogap/errors"
+	"github.com/gogap/spirit"
+)
+
+const (
+	RateLimitIdentityIp        = "ip"
+	RateLimitIdentityPrincipal = "principal"
+
+	RateLimitIdentityHeaderPrefix = "header:"
+	RateLimitIdentityCookiePrefix = "cookie:"
+
+	RateLimitStoreMemory = "memory"
+)
+
+var (
+	rateLimitBucketIdleTimeout = time.Minute * 10
+)
+
+// RateLimitRule is the token bucket refilled by rate tokens per second, the
+// rule with zero rate is not limited
+type RateLimitRule struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+func (p RateLimitRule) IsEnabled() bool {
+	return p.Rate > 0
+}
+
+func (p RateLimitRule) burst() float64 {
+	if p.Burst > 0 {
+		return float64(p.Burst)
+	}
+	return math.Max(1, math.Ceil(p.Rate))
+}
+
+// RateLimitConfig limits the calls globally, by api, by client and by client
+// of api, each entry of multi call is counted as a call. the client identity
+// is the remote ip, the authenticated principal, or the value of header or
+// cookie declared as "header:X-Api-Key" or "cookie:session"
+type RateLimitConfig struct {
+	Global     RateLimitRule            `json:"global"`
+	Apis       map[string]RateLimitRule `json:"apis"`
+	Client     RateLimitRule            `json:"client"`
+	ClientApis map[string]RateLimitRule `json:"client_apis"`
+
+	Identity          string `json:"identity"`
+	TrustForwardedFor bool   `json:"trust_forwarded_for"`
+
+	Store        string     `json:"store"`
+	StoreOptions spirit.Map `json:"store_options"`
+}
+
+func (p *RateLimitConfig) initial() {
+	if p.Identity == "" {
+		p.Identity = RateLimitIdentityIp
+	}
+
+	if p.Store == "" {
+		p.Store = RateLimitStoreMemory
+	}
+}
+
+func (p *RateLimitConfig) IsEnabled() bool {
+	return p.Global.IsEnabled() || p.Client.IsEnabled() || len(p.Apis) > 0 || len(p.ClientApis) > 0
+}
+
+// RateLimitStore keeps the token buckets, the shared store makes the limits
+// work across receivers
+type RateLimitStore interface {
+	// Take takes n tokens from the bucket of key, retryAfter is the duration
+	// to wait for enough tokens if the call is not allowed. the n more than
+	// burst is never allowed
+	Take(key string, rule RateLimitRule, n int) (allowed bool, retryAfter time.Duration, err error)
+
+	// Refund returns the n tokens taken from the bucket of key, the tokens
+	// taken by the call are refunded if the call is rejected by other buckets
+	Refund(key string, rule RateLimitRule, n int) (err error)
+}
+
+type NewRateLimitStoreFunc func(options spirit.Map) (store RateLimitStore, err error)
+
+var rateLimitStores = map[string]NewRateLimitStoreFunc{
+	RateLimitStoreMemory: func(options spirit.Map) (RateLimitStore, error) {
+		return NewMemoryRateLimitStore(), nil
+	},
+}
+
+// RegisterRateLimitStore registers the store could be used in rate limit config
+func RegisterRateLimitStore(name string, fn NewRateLimitStoreFunc) {
+	rateLimitStores[name] = fn
+}
+
+func newRateLimitStore(conf RateLimitConfig) (store RateLimitStore, err error) {
+	fn, exist := rateLimitStores[conf.Store]
+	if !exist {
+		err = ErrLoadRateLimitStoreFailed.New(errors.Params{"store": conf.Store, "err": "store not exist"})
+		return
+	}
+
+	options := conf.StoreOptions
+	if options == nil {
+		options = spirit.Map{}
+	}
+
+	if store, err = fn(options); err != nil {
+		err = ErrLoadRateLimitStoreFailed.New(errors.Params{"store": conf.Store, "err": err})
+		return
+	}
+
+	return
+}
+
+type RateLimitError struct {
+	errors.ErrCode
+	RetryAfter time.Duration
+}
+
+func newRateLimitError(apiName string, retryAfter time.Duration) *RateLimitError {
+	return &RateLimitError{
+		ErrCode:    ErrRateLimitExceeded.New(errors.Params{"apiName": apiName}),
+		RetryAfter: retryAfter,
+	}
+}
+
+// rateLimit takes the tokens of the calls from the buckets, the calls of
+// internal multi call layers were counted before dispatching
+func (p *JsonApiReceiver) rateLimit(req *gohttp.Request, apiNames []string, principals map[string]*AuthPrincipal) (err error) {
+	if p.rateLimitStore == nil {
+		return
+	}
+
+	if _, isLayer := multiCallLayerPrincipals(req); isLayer {
+		return
+	}
+
+	conf := p.conf.RateLimit
+
+	counts := map[string]int{}
+	for _, apiName := range apiNames {
+		counts[apiName]++
+	}
+
+	type rateLimitTake struct {
+		apiName string
+		key     string
+		rule    RateLimitRule
+		n       int
+	}
+
+	identity := p.rateLimitIdentity(req, principals)
+
+	// the narrowest buckets are taken first, so the rejected calls of a
+	// client drain the global bucket as little as possible
+	takes := []rateLimitTake{}
+
+	apis := []string{}
+	for apiName := range counts {
+		apis = append(apis, apiName)
+	}
+	sort.Strings(apis)
+
+	for _, apiName := range apis {
+		takes = append(takes, rateLimitTake{apiName, "client_api:" + identity + ":" + apiName, conf.ClientApis[apiName], counts[apiName]})
+	}
+
+	for _, apiName := range apis {
+		takes = append(takes, rateLimitTake{apiName, "api:" + apiName, conf.Apis[apiName], counts[apiName]})
+	}
+
+	takes = append(takes,
+		rateLimitTake{"*", "client:" + identity, conf.Client, len(apiNames)},
+		rateLimitTake{"*", "global", conf.Global, len(apiNames)},
+	)
+
+	logError := func(key string, err error) {
+		spirit.Logger().
+			WithField("event", "rate limit").
+			WithField("urn", p.URN()).
+			WithField("name", p.Name()).
+			WithField("key", key).
+			Errorln(err)
+	}
+
+	taken := []rateLimitTake{}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		for _, refund := range taken {
+			if e := p.rateLimitStore.Refund(p.name+":"+refund.key, refund.rule, refund.n); e != nil {
+				logError(refund.key, e)
+			}
+		}
+	}()
+
+	for _, take := range takes {
+		if !take.rule.IsEnabled() {
+			continue
+		}
+
+		// the calls more than burst could never be allowed, so the
+		// client should not retry
+		if burst := take.rule.burst(); float64(take.n) > burst {
+			err = ErrRateLimitBatchTooLarge.New(errors.Params{"apiName": take.apiName, "count": take.n, "burst": burst})
+			return
+		}
+
+		allowed, retryAfter, e := p.rateLimitStore.Take(p.name+":"+take.key, take.rule, take.n)
+		if e != nil {
+			logError(take.key, e)
+			continue
+		}
+
+		if allowed {
+			taken = append(taken, take)
+			continue
+		}
+
+		err = newRateLimitError(take.apiName, retryAfter)
+
+		return
+	}
+
+	return
+}
+
+func (p *JsonApiReceiver) rateLimitIdentity(req *gohttp.Request, principals map[string]*AuthPrincipal) (identity string) {
+	conf := p.conf.RateLimit
+
+	switch {
+	case conf.Identity == RateLimitIdentityPrincipal:
+		for _, principal := range principals {
+			if principal.Principal != "" {
+				return principal.Verifier + ":" + principal.Principal
+			}
+		}
+	case strings.HasPrefix(conf.Identity, RateLimitIdentityHeaderPrefix):
+		if value := req.Header.Get(strings.TrimPrefix(conf.Identity, RateLimitIdentityHeaderPrefix)); value != "" {
+			return value
+		}
+	case strings.HasPrefix(conf.Identity, RateLimitIdentityCookiePrefix):
+		if cookie, e := req.Cookie(strings.TrimPrefix(conf.Identity, RateLimitIdentityCookiePrefix)); e == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	}
+
+	// the requests without identity are limited by ip
+	return "ip:" + clientIp(req, conf.TrustForwardedFor)
+}
+
+func clientIp(req *gohttp.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		if forwardedFor := req.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+			return strings.TrimSpace(strings.Split(forwardedFor, ",")[0])
+		}
+	}
+
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+
+	return req.RemoteAddr
+}
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// MemoryRateLimitStore keeps the token buckets in process
+type MemoryRateLimitStore struct {
+	buckets  map[string]*tokenBucket
+	purgedAt time.Time
+	locker   sync.Mutex
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:  make(map[string]*tokenBucket),
+		purgedAt: time.Now(),
+	}
+}
+
+func (p *MemoryRateLimitStore) Take(key string, rule RateLimitRule, n int) (allowed bool, retryAfter time.Duration, err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	now := time.Now()
+	burst := rule.burst()
+
+	if now.Sub(p.purgedAt) > rateLimitBucketIdleTimeout {
+		for k, bucket := range p.buckets {
+			if now.Sub(bucket.updatedAt) > rateLimitBucketIdleTimeout {
+				delete(p.buckets, k)
+			}
+		}
+		p.purgedAt = now
+	}
+
+	bucket := p.refill(key, burst, rule.Rate, now)
+
+	// the bucket never holds more than burst tokens
+	tokens := float64(n)
+	if tokens > burst {
+		return
+	}
+
+	if bucket.tokens >= tokens {
+		bucket.tokens -= tokens
+		allowed = true
+		return
+	}
+
+	retryAfter = time.Duration((tokens - bucket.tokens) / rule.Rate * float64(time.Second))
+
+	return
+}
+
+func (p *MemoryRateLimitStore) Refund(key string, rule RateLimitRule, n int) (err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	burst := rule.burst()
+
+	bucket := p.refill(key, burst, rule.Rate, time.Now())
+	bucket.tokens = math.Min(burst, bucket.tokens+float64(n))
+
+	return
+}
+
+func (p *MemoryRateLimitStore) refill(key string, burst, rate float64, now time.Time) *tokenBucket {
+	bucket, exist := p.buckets[key]
+	if !exist {
+		bucket = &tokenBucket{tokens: burst, updatedAt: now}
+		p.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.updatedAt).Seconds()*rate)
+	bucket.updatedAt = now
+
+	return bucket
+}
@@ -0,0 +1,128 @@
+package http_json_api
+
+import (
+	gohttp "net/http"
+	"testing"
+)
+
+func TestMemoryRateLimitStoreTake(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	rule := RateLimitRule{Rate: 0.001, Burst: 3}
+
+	cases := []struct {
+		n      int
+		expect bool
+	}{
+		{1, true},
+		{2, true},
+		{1, false},
+	}
+
+	for i, c := range cases {
+		allowed, retryAfter, err := store.Take("k", rule, c.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if allowed != c.expect {
+			t.Errorf("take %d: expect allowed %v, got %v", i, c.expect, allowed)
+		}
+
+		if !allowed && retryAfter <= 0 {
+			t.Errorf("take %d: expect retry after of rejected take", i)
+		}
+	}
+}
+
+func TestMemoryRateLimitStoreTakeMoreThanBurst(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	rule := RateLimitRule{Rate: 0.001, Burst: 2}
+
+	if allowed, retryAfter, _ := store.Take("k", rule, 5); allowed || retryAfter != 0 {
+		t.Fatalf("expect the take more than burst never allowed, got %v %v", allowed, retryAfter)
+	}
+
+	if allowed, _, _ := store.Take("k", rule, 2); !allowed {
+		t.Errorf("expect the bucket not drained by the take more than burst")
+	}
+}
+
+func TestMemoryRateLimitStoreRefund(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	rule := RateLimitRule{Rate: 0.001, Burst: 2}
+
+	store.Take("k", rule, 2)
+	store.Refund("k", rule, 5)
+
+	if allowed, _, _ := store.Take("k", rule, 2); !allowed {
+		t.Fatalf("expect the refunded tokens taken")
+	}
+
+	if allowed, _, _ := store.Take("k", rule, 1); allowed {
+		t.Errorf("expect the refund capped by burst")
+	}
+}
+
+func TestRateLimitBuckets(t *testing.T) {
+	conf := RateLimitConfig{
+		Global:     RateLimitRule{Rate: 0.001, Burst: 3},
+		Client:     RateLimitRule{Rate: 0.001, Burst: 10},
+		Apis:       map[string]RateLimitRule{"order.list": {Rate: 0.001, Burst: 10}},
+		ClientApis: map[string]RateLimitRule{"order.list": {Rate: 0.001, Burst: 1}},
+	}
+	conf.initial()
+
+	receiver := &JsonApiReceiver{
+		name:           "test",
+		conf:           JsonApiReceiverConfig{RateLimit: conf},
+		rateLimitStore: NewMemoryRateLimitStore(),
+	}
+
+	newReq := func(remoteAddr string) *gohttp.Request {
+		req, _ := gohttp.NewRequest("POST", "/api", nil)
+		req.RemoteAddr = remoteAddr
+		return req
+	}
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		apis       []string
+		expect     bool
+	}{
+		{"first call of client", "10.0.0.1:1000", []string{"order.list"}, true},
+		{"client api exceeded", "10.0.0.1:1000", []string{"order.list"}, false},
+		{"rejected again", "10.0.0.1:1000", []string{"order.list"}, false},
+		{"other client", "10.0.0.2:1000", []string{"order.get"}, true},
+		{"global not drained by rejected calls", "10.0.0.3:1000", []string{"order.get"}, true},
+		{"global exceeded", "10.0.0.4:1000", []string{"order.list"}, false},
+		{"global still exceeded", "10.0.0.4:1000", []string{"order.get"}, false},
+	}
+
+	for _, c := range cases {
+		err := receiver.rateLimit(newReq(c.remoteAddr), c.apis, nil)
+
+		if (err == nil) != c.expect {
+			t.Errorf("%s: expect allowed %v, got %v", c.name, c.expect, err)
+		}
+
+		if err != nil {
+			if _, ok := err.(*RateLimitError); !ok {
+				t.Errorf("%s: expect rate limit error, got %T", c.name, err)
+			}
+		}
+	}
+
+	// the multi call more than burst is rejected without taking tokens
+	err := receiver.rateLimit(newReq("10.0.0.5:1000"), []string{"order.get", "order.get", "order.get", "order.get"}, nil)
+	if !ErrRateLimitBatchTooLarge.IsEqual(err) {
+		t.Errorf("expect batch too large error, got %v", err)
+	}
+
+	// the client api bucket of 10.0.0.4 was refunded once the global bucket
+	// rejected the call
+	store := receiver.rateLimitStore.(*MemoryRateLimitStore)
+	if allowed, _, _ := store.Take("test:client_api:ip:10.0.0.4:order.list", conf.ClientApis["order.list"], 1); !allowed {
+		t.Errorf("expect the client api bucket refunded")
+	}
+}
@@ -1,10 +1,12 @@
 package http_json_api
 
 import (
+	"bytes"
 	"encoding/json"
 	"github.com/gogap/errors"
 	"github.com/rs/xid"
 	"io/ioutil"
+	"math"
 	gohttp "net/http"
 	"strconv"
 	"strings"
@@ -25,7 +27,23 @@ type JsonApiReceiver struct {
 
 	*http.HTTPReceiver
 
-	responseRenderer *APIResponseRenderer
+	rendererReloader *APIResponseRendererReloader
+
+	apiSchemas map[string]*JsonSchema
+
+	authVerifiers map[string]AuthVerifier
+
+	rateLimitStore RateLimitStore
+
+	idempotencyStore IdempotencyStore
+
+	responseCacheStore ResponseCacheStore
+
+	metrics *receiverMetrics
+
+	tracer *tracer
+
+	deliveryWindow *deliveryWindow
 
 	htmlProxy string
 }
@@ -56,15 +74,49 @@ func NewJsonApiReceiver(name string, options spirit.Map) (receiver spirit.Receiv
 		return
 	}
 
-	jsonApiReceiver.responseRenderer = NewAPIResponseRenderer()
+	if jsonApiReceiver.rendererReloader, err = NewAPIResponseRendererReloader(conf.Renderer); err != nil {
+		return
+	}
 
-	path := strings.TrimRight(conf.Path, "/")
-	jsonApiReceiver.Group(path, func(r martini.Router) {
-		r.Post("", jsonApiReceiver.HTTPReceiver.Handler)
-		r.Post("/:apiName", jsonApiReceiver.HTTPReceiver.Handler)
-		r.Options("", jsonApiReceiver.optionHandle)
-		r.Options("/:apiName", jsonApiReceiver.optionHandle)
-	})
+	jsonApiReceiver.apiSchemas = make(map[string]*JsonSchema)
+	for apiName, schemaConf := range conf.ApiSchema {
+		var schema *JsonSchema
+		if schema, err = NewJsonSchema(schemaConf); err != nil {
+			err = ErrLoadApiSchemaFailed.New(errors.Params{"apiName": apiName}).Append(err)
+			return
+		}
+		jsonApiReceiver.apiSchemas[apiName] = schema
+	}
+
+	if jsonApiReceiver.authVerifiers, err = newAuthVerifiers(conf.Auth); err != nil {
+		return
+	}
+
+	if conf.RateLimit.IsEnabled() {
+		if jsonApiReceiver.rateLimitStore, err = newRateLimitStore(conf.RateLimit); err != nil {
+			return
+		}
+	}
+
+	if conf.Idempotency.IsEnabled() {
+		if jsonApiReceiver.idempotencyStore, err = newIdempotencyStore(conf.Idempotency); err != nil {
+			return
+		}
+	}
+
+	if conf.ResponseCache.IsEnabled() {
+		if jsonApiReceiver.responseCacheStore, err = newResponseCacheStore(conf.ResponseCache); err != nil {
+			return
+		}
+	}
+
+	jsonApiReceiver.metrics = newReceiverMetrics(name, conf.Metrics, conf.apiNames())
+
+	jsonApiReceiver.deliveryWindow = newDeliveryWindow(conf.Health.TimeoutWindow)
+
+	if jsonApiReceiver.tracer, err = newTracer(conf.Trace); err != nil {
+		return
+	}
 
 	jsonApiReceiver.htmlProxy = strings.Replace(proxyHtml, "{{#XDomainLib#}}", conf.XDomain.LibUrl, 1)
 
@@ -73,6 +125,20 @@ func NewJsonApiReceiver(name string, options spirit.Map) (receiver spirit.Receiv
 			return "pong"
 		})
 
+		r.Get("healthz", jsonApiReceiver.healthzHandle)
+		r.Get("readyz", jsonApiReceiver.readyzHandle)
+
+		if conf.Health.Info {
+			r.Get("info", jsonApiReceiver.infoHandle)
+		}
+
+		if conf.Metrics.Enabled {
+			r.Get(strings.TrimLeft(conf.Metrics.Path, "/"), func(w gohttp.ResponseWriter) {
+				w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+				jsonApiReceiver.metrics.Write(w)
+			})
+		}
+
 		if conf.XDomain.HtmlPath != "" {
 			r.Get(conf.XDomain.HtmlPath, func(r *gohttp.Request) string {
 				refer := r.Referer()
@@ -109,6 +175,20 @@ func NewJsonApiReceiver(name string, options spirit.Map) (receiver spirit.Receiv
 		}
 	})
 
+	// the api routes are registered after the built-in routes, otherwise
+	// GET /:apiName shadows them while the path is "/"
+	path := strings.TrimRight(conf.Path, "/")
+	jsonApiReceiver.Group(path, func(r martini.Router) {
+		r.Post("", jsonApiReceiver.HTTPReceiver.Handler)
+		r.Post("/:apiName", jsonApiReceiver.HTTPReceiver.Handler)
+		if conf.GetRequest.Enabled {
+			r.Get("", jsonApiReceiver.HTTPReceiver.Handler)
+			r.Get("/:apiName", jsonApiReceiver.HTTPReceiver.Handler)
+		}
+		r.Options("", jsonApiReceiver.optionHandle)
+		r.Options("/:apiName", jsonApiReceiver.optionHandle)
+	})
+
 	receiver = jsonApiReceiver
 	return
 }
@@ -121,6 +201,22 @@ func (p *JsonApiReceiver) URN() string {
 	return receiverURN
 }
 
+func (p *JsonApiReceiver) Start() (err error) {
+	if err = p.HTTPReceiver.Start(); err != nil {
+		return
+	}
+
+	p.rendererReloader.Start()
+
+	return
+}
+
+func (p *JsonApiReceiver) Stop() (err error) {
+	p.rendererReloader.Stop()
+
+	return p.HTTPReceiver.Stop()
+}
+
 func (p *JsonApiReceiver) optionHandle(w gohttp.ResponseWriter, r *gohttp.Request) {
 	if r.Method == "OPTIONS" {
 		p.writeAccessHeaders(w, r)
@@ -136,48 +232,106 @@ func (p *JsonApiReceiver) requestHandler(
 	done chan<- bool,
 ) (deliveries []spirit.Delivery, err error) {
 
-	var apiIds map[string]string
+	startAt := time.Now()
 
-	// request to deliveries
-	if deliveries, apiIds, err = p.toDeliveries(req); err != nil {
+	var access *accessLog
+	access, res = p.beginAccessLog(res, req, startAt)
 
-		var apiResponse APIResponse
+	span := p.tracer.StartRequestSpan(req)
 
-		switch errCode := err.(type) {
-		case errors.ErrCode:
-			{
-				apiResponse = APIResponse{
-					Code:           errCode.Code(),
-					ErrorId:        errCode.Id(),
-					ErrorNamespace: errCode.Namespace(),
-					Message:        errCode.Error(),
-					Result:         nil,
-				}
+	var uploads *uploadFiles
+	if p.conf.Upload.Mode == UploadModeSpool {
+		req, uploads = withUploadFiles(req)
+	}
+
+	// the access log and request span are written and the spooled files are
+	// removed once the response written
+	var watched chan<- bool
+	if p.conf.AccessLog.Enabled || p.tracer != nil || uploads != nil {
+		watched = watchDone(done, func() {
+			if uploads != nil {
+				uploads.removeAll()
 			}
-		default:
-			e := ErrApiGenericError.New().Append(err)
-			apiResponse = APIResponse{
-				Code:           e.Code(),
-				ErrorId:        e.Id(),
-				ErrorNamespace: e.Namespace(),
-				Message:        e.Error(),
-				Result:         nil,
+			p.tracer.EndSpan(span, nil)
+			p.writeAccessLog(access, req)
+		})
+		done = watched
+	}
+
+	defer func() {
+		if err != nil {
+			access.err = err
+			span.SetAttribute("error", err.Error())
+
+			if watched != nil {
+				watched <- false
 			}
 		}
+	}()
 
-		if data, e := json.Marshal(apiResponse); e != nil {
-			spirit.Logger().
-				WithField("event", "to deliveries").
-				WithField("urn", p.URN()).
-				WithField("name", p.Name()).
-				Errorln(err)
-		} else {
-			p.writeResponse(data, res, req)
+	var apiIds map[string]string
+
+	// multi call with dependencies is dispatched layer by layer
+	if p.isMultiCall(req) && !p.isForwarded(req) && !p.isMultiCallLayer(req) && req.Method != "GET" {
+		var graph *multiCallGraph
+		if graph, err = p.toMultiCallGraph(req); err != nil {
+			p.metrics.ObserveResponse("", p.errorToApiResponse(err), time.Since(startAt))
+			p.writeErrorResponse(err, res, req)
+			return
+		}
+
+		if graph != nil {
+			go p.serveMultiCallGraph(graph, access, res, req, done)
+			return
 		}
+	}
+
+	// request to deliveries
+	if deliveries, apiIds, err = p.toDeliveries(req); err != nil {
+		p.metrics.ObserveResponse("", p.errorToApiResponse(err), time.Since(startAt))
+		p.writeErrorResponse(err, res, req)
+		return
+	}
+
+	callApis := deliveryApiNames(deliveries, apiIds)
+
+	access.apiIds = apiIds
+	access.callApis = callApis
+
+	// the cached response is written without dispatching
+	cached := p.lookupResponseCache(req, deliveries)
+	if cached != nil && cached.entry != nil {
+		deliveries = nil
+		go p.writeCachedResponse(cached, access, res, req, done)
+		return
+	}
 
+	// the duplicate of idempotent call is replayed without dispatching
+	var idempotent *idempotentCall
+	if idempotent, err = p.beginIdempotentCall(req, deliveries); err != nil {
+		deliveries = nil
+		p.writeErrorResponse(err, res, req)
 		return
 	}
 
+	if idempotent != nil {
+		if idempotent.existing != nil {
+			deliveries = nil
+			go p.replayIdempotentCall(idempotent, access, res, req, done)
+			return
+		}
+
+		res = p.recordIdempotentCall(idempotent, res)
+	}
+
+	if cached != nil {
+		res = p.recordResponseCache(cached, res)
+	}
+
+	p.metrics.AddInflight(len(deliveries))
+
+	spans := p.tracer.StartDeliverySpans(deliveries, req)
+
 	go func(
 		count int,
 		apiIds map[string]string,
@@ -186,34 +340,27 @@ func (p *JsonApiReceiver) requestHandler(
 		deliveryChan <-chan spirit.Delivery,
 		done chan<- bool) {
 
-		defer func() {
-			// notify the main handler finished
-			select {
-			case done <- true:
-				{
-				}
-			case <-time.After(time.Second * 3):
-				{
-				}
-			}
-		}()
+		defer notifyDone(done)
 
-		// get timeout duration
-		timeout := time.Duration(p.conf.Timeout) * time.Millisecond
+		apiResponse := map[string]APIResponse{}
 
-		if strTimeout := req.Header.Get(p.conf.HeaderDefines.TimeoutHeader); strTimeout != "" {
-			if i, e := strconv.Atoi(strTimeout); e == nil {
-				timeout = time.Duration(i) * time.Millisecond
-			}
+		if idempotent != nil {
+			defer p.finishIdempotentCall(idempotent, apiResponse)
 		}
 
-		if timeout <= 0 {
-			timeout = DefaultTimeout
+		if cached != nil {
+			defer p.finishResponseCache(cached, apiResponse, req)
 		}
 
-		apiResponse := map[string]APIResponse{}
+		// get timeout duration
+		timeout := p.requestTimeout(req)
+
+		isForwardedMultiCall := p.isMultiCall(req) && p.isForwarded(req)
+		isForwardedResponse := p.isForwardedResponse(req)
 
 		i := count
+		defer func() { p.metrics.AddInflight(-count) }()
+
 		// get deliveries
 	label_timeout_or_finished:
 		for i > 0 {
@@ -228,8 +375,18 @@ func (p *JsonApiReceiver) requestHandler(
 							WithField("delivery_id", delivery.Id()).
 							Errorln("api not exist in request while delivery response")
 
+						p.metrics.IncOrphaned()
+
 					} else {
-						apiResponse[api] = p.deliveryToApiResponse(delivery)
+						if isForwardedMultiCall || isForwardedResponse {
+							apiResponse[api] = p.deliveryToForwardedApiResponse(delivery)
+						} else {
+							apiResponse[api] = p.deliveryToApiResponse(delivery)
+						}
+
+						resp := apiResponse[api]
+						p.tracer.EndSpan(spans[delivery.Id()], &resp)
+						delete(spans, delivery.Id())
 					}
 
 					i = i - 1
@@ -255,73 +412,161 @@ func (p *JsonApiReceiver) requestHandler(
 			}
 		}
 
-		// render deliveries to json response
-		// normal response: {"code": 0, "message": "", "result": null}
-		// error response: {"code": 212, "error_namespace": "xxxx", "message": "something wrong", "result": null}
+		p.deliveryWindow.Observe(count, i)
 
-		isMultiCall := req.Header.Get(p.conf.HeaderDefines.MultiCallHeader) == "1" ||
-			req.Header.Get(p.conf.HeaderDefines.MultiCallHeader) == "on" ||
-			req.Header.Get(p.conf.HeaderDefines.MultiCallHeader) == "true"
+		// the dispatch spans of timed out deliveries
+		for id, span := range spans {
+			resp := apiResponse[apiIds[id]]
+			p.tracer.EndSpan(span, &resp)
+		}
 
-		if renderedData, e := p.responseRenderer.Render(isMultiCall, apiResponse); e != nil {
-			err := ErrRenderApiDataFailed.New(errors.Params{"err": e})
-			resp := APIResponse{
-				Code:           err.Code(),
-				ErrorId:        err.Id(),
-				ErrorNamespace: err.Namespace(),
-				Message:        err.Error(),
-				Result:         nil,
-			}
+		access.responses = apiResponse
 
-			if errRespData, e := json.Marshal(resp); e != nil {
-				strInternalErr := `{"code": 500, "message": "api server internal error", "result": null}`
-				p.writeResponseWithStatusCode([]byte(strInternalErr), res, req, gohttp.StatusInternalServerError)
-			} else {
-				p.writeResponse(errRespData, res, req)
-			}
-		} else {
-			p.writeResponse(renderedData, res, req)
+		if p.isMultiCallLayer(req) {
+			p.writeMultiCallLayerResponse(apiResponse, res, req)
+			return
+		}
+
+		// the calls of layers are observed by the multi call graph
+		if p.isMultiCall(req) {
+			p.metrics.ObserveMultiCall(count)
 		}
+		p.metrics.ObserveResponses(apiResponse, callApis, time.Since(startAt))
+
+		if isForwardedMultiCall {
+			p.writeForwardedMultiCallResponse(apiResponse, res, req)
+			return
+		}
+
+		if isForwardedResponse {
+			p.writeForwardedResponse(apiResponse, res, req)
+			return
+		}
+
+		// the render failure is not the response of api, so the idempotency
+		// key is released
+		if e := p.renderAndWriteResponse(p.isMultiCall(req), apiResponse, res, req); e != nil && idempotent != nil {
+			idempotent.renderFailed = true
+		}
+
 		return
 	}(len(deliveries), apiIds, res, req, deliveryChan, done)
 
 	return
 }
 
+func (p *JsonApiReceiver) isMultiCall(req *gohttp.Request) bool {
+	return isSwitchOn(req.Header.Get(p.conf.HeaderDefines.MultiCallHeader))
+}
+
+func (p *JsonApiReceiver) isForwarded(req *gohttp.Request) bool {
+	return isSwitchOn(req.Header.Get(HeaderForwardedPayload))
+}
+
+// isForwardedResponse is true if the forwarded call asks for the whole
+// updated payload instead of the rendered result
+func (p *JsonApiReceiver) isForwardedResponse(req *gohttp.Request) bool {
+	return p.isForwarded(req) && !p.isMultiCall(req) && isSwitchOn(req.Header.Get(HeaderForwardedResponse))
+}
+
+// isMultiCallLayer is true only for the internal layer requests marked in
+// request context, the marker could not be set by the clients
+func (p *JsonApiReceiver) isMultiCallLayer(req *gohttp.Request) bool {
+	_, isLayer := multiCallLayerPrincipals(req)
+	return isLayer
+}
+
+func (p *JsonApiReceiver) requestTimeout(req *gohttp.Request) (timeout time.Duration) {
+	timeout = time.Duration(p.conf.Timeout) * time.Millisecond
+
+	if strTimeout := req.Header.Get(p.conf.HeaderDefines.TimeoutHeader); strTimeout != "" {
+		if i, e := strconv.Atoi(strTimeout); e == nil {
+			timeout = time.Duration(i) * time.Millisecond
+		}
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return
+}
+
 func (p *JsonApiReceiver) toDeliveries(req *gohttp.Request) (deliveries []spirit.Delivery, apiIds map[string]string, err error) {
-	isMultiCall := req.Header.Get(p.conf.HeaderDefines.MultiCallHeader) == "1" ||
-		req.Header.Get(p.conf.HeaderDefines.MultiCallHeader) == "on" ||
-		req.Header.Get(p.conf.HeaderDefines.MultiCallHeader) == "true"
+	isMultiCall := p.isMultiCall(req)
+	isForwarded := p.isForwarded(req)
 
-	isForwarded := req.Header.Get(HeaderForwardedPayload) == "1" ||
-		req.Header.Get(HeaderForwardedPayload) == "on" ||
-		req.Header.Get(HeaderForwardedPayload) == "true"
+	isGet := req.Method == "GET"
 
-	if isMultiCall == true && isForwarded == true {
-		err = ErrNotSupportMultiCallForward.New()
+	if isGet && (isMultiCall || isForwarded) {
+		err = ErrGetNotSupportMultiCallForward.New()
 		return
 	}
 
 	idMapping := make(map[string]string)
 
+	isForm := !isGet && !isMultiCall && !isForwarded && isFormRequest(req)
+
 	var body []byte
-	if body, err = ioutil.ReadAll(req.Body); err != nil {
-		return
+	if !isGet && !isForm {
+		if body, err = p.readJsonBody(req); err != nil {
+			return
+		}
 	}
 
 	var apiDatas map[string]interface{} = make(map[string]interface{})
 
-	if isMultiCall {
-		if err = json.Unmarshal(body, &apiDatas); err != nil {
+	var principals map[string]*AuthPrincipal
+
+	// call name to api name of the multi call entries declared as call
+	callApis := map[string]string{}
+
+	if isMultiCall && isForwarded {
+		if err = p.conf.ForwardedSign.Verify(req, "", body); err != nil {
+			return
+		}
+
+		forwardedDatas := map[string]json.RawMessage{}
+		if err = decodeJsonBody(body, &forwardedDatas); err != nil {
+			return
+		}
+
+		for callName, rawData := range forwardedDatas {
+			call := forwardedMultiCall{}
+			if err = decodeJsonBody(rawData, &call); err != nil {
+				return
+			}
+
+			if call.Api != "" {
+				callApis[callName] = call.Api
+				apiDatas[callName] = call.Data
+				continue
+			}
+
+			apiData := JsonPayload{}
+			if err = decodeJsonBody(rawData, &apiData); err != nil {
+				return
+			}
+			apiDatas[callName] = apiData
+		}
+	} else if isMultiCall {
+		if err = decodeJsonBody(body, &apiDatas); err != nil {
 			return
 		}
+
+		for callName, apiData := range apiDatas {
+			if call, isCall := parseMultiCall(callName, apiData); isCall {
+				callApis[callName] = call.api
+				apiDatas[callName] = call.data
+			}
+		}
 	} else {
 
 		apiName := req.Header.Get(p.conf.HeaderDefines.ApiHeader)
 
 		if apiName == "" {
-			if p.conf.Path != req.RequestURI {
-				apiName = strings.TrimPrefix(req.RequestURI, p.conf.Path)
+			if p.conf.Path != req.URL.Path {
+				apiName = strings.TrimPrefix(req.URL.Path, p.conf.Path)
 				apiName = strings.TrimRight(apiName, "/")
 			}
 		}
@@ -331,15 +576,41 @@ func (p *JsonApiReceiver) toDeliveries(req *gohttp.Request) (deliveries []spirit
 			return
 		}
 
-		if isForwarded {
+		if isGet {
+			if !p.conf.GetRequest.IsAllowed(apiName) {
+				err = ErrApiNotAllowedGet.New(errors.Params{"apiName": apiName})
+				return
+			}
+			apiDatas[apiName] = queryToData(req.URL.Query())
+		} else if isForm {
+			// the form is authenticated and limited before parsing, so the
+			// rejected requests never spool their files
+			if principals, err = p.authenticate(req, []string{apiName}, nil); err != nil {
+				return
+			}
+
+			if err = p.rateLimit(req, []string{apiName}, principals); err != nil {
+				return
+			}
+
+			var apiData map[string]interface{}
+			if apiData, err = p.formToData(apiName, req); err != nil {
+				return
+			}
+			apiDatas[apiName] = apiData
+		} else if isForwarded {
+			if err = p.conf.ForwardedSign.Verify(req, apiName, body); err != nil {
+				return
+			}
+
 			apiData := JsonPayload{}
-			if json.Unmarshal(body, &apiData); err != nil {
+			if err = decodeJsonBody(body, &apiData); err != nil {
 				return
 			}
 			apiDatas[apiName] = apiData
 		} else {
 			var apiData map[string]interface{}
-			if json.Unmarshal(body, &apiData); err != nil {
+			if err = decodeJsonBody(body, &apiData); err != nil {
 				return
 			}
 			apiDatas[apiName] = apiData
@@ -347,8 +618,35 @@ func (p *JsonApiReceiver) toDeliveries(req *gohttp.Request) (deliveries []spirit
 
 	}
 
+	apiNames := []string{}
+	for callName := range apiDatas {
+		if callApi, exist := callApis[callName]; exist {
+			apiNames = append(apiNames, callApi)
+		} else {
+			apiNames = append(apiNames, callName)
+		}
+	}
+
+	// the forwarded payloads carry the auth context of the first receiver
+	if !isForm {
+		if !isForwarded || !p.conf.ForwardedSign.IsEnabled() {
+			if principals, err = p.authenticate(req, apiNames, body); err != nil {
+				return
+			}
+		}
+
+		if err = p.rateLimit(req, apiNames, principals); err != nil {
+			return
+		}
+	}
+
 	var tmpDeliveries []spirit.Delivery
-	for api, apiData := range apiDatas {
+	for callName, apiData := range apiDatas {
+
+		api := callName
+		if callApi, exist := callApis[callName]; exist {
+			api = callApi
+		}
 
 		payload := NewHttpJsonApiPayload()
 
@@ -358,6 +656,15 @@ func (p *JsonApiReceiver) toDeliveries(req *gohttp.Request) (deliveries []spirit
 				payload.data = jsonPayload.Data
 				payload.context = jsonPayload.Context
 				payload.errs = jsonPayload.Errors
+
+				if payload.context == nil {
+					payload.context = make(spirit.Map)
+				}
+
+				// the auth context is trusted only if the payload is signed
+				if !p.conf.ForwardedSign.IsEnabled() {
+					delete(payload.context, CtxHttpAuth)
+				}
 			}
 		} else {
 			payload.SetData(apiData)
@@ -390,6 +697,20 @@ func (p *JsonApiReceiver) toDeliveries(req *gohttp.Request) (deliveries []spirit
 			}
 		}
 
+		if principal := principals[api]; principal != nil {
+			payload.SetContext(CtxHttpAuth, principal)
+		}
+
+		// the forwarded payload keeps the correlation id of the first receiver
+		if _, exist := payload.GetContext(CtxHttpCorrelationId); !exist {
+			payload.SetContext(CtxHttpCorrelationId, req.Header.Get(p.conf.HeaderDefines.CorrelationIdHeader))
+		}
+
+		trace, parentSpanId, traced := p.tracer.deliveryTraceContext(req)
+		if traced {
+			payload.SetContext(CtxHttpTrace, trace.toMap(parentSpanId))
+		}
+
 		deliveryURN := ""
 		if urn, exist := p.conf.ApiURN[api]; exist {
 			deliveryURN = urn
@@ -424,6 +745,10 @@ func (p *JsonApiReceiver) toDeliveries(req *gohttp.Request) (deliveries []spirit
 			}
 		}
 
+		if traced {
+			metadata[MetadataTrace] = trace.toMap(parentSpanId)
+		}
+
 		de := &HttpJsonApiDelivery{
 			id:        xid.New().String(),
 			payload:   payload,
@@ -431,11 +756,18 @@ func (p *JsonApiReceiver) toDeliveries(req *gohttp.Request) (deliveries []spirit
 			labels:    labels,
 			timestamp: time.Now(),
 			metadata:  metadata,
+			apiName:   api,
+			schema:    p.apiSchemas[api],
+			trace:     trace,
+		}
+
+		if err = de.Validate(); err != nil {
+			return
 		}
 
 		tmpDeliveries = append(tmpDeliveries, de)
 
-		idMapping[de.id] = api
+		idMapping[de.id] = callName
 	}
 
 	deliveries = tmpDeliveries
@@ -444,6 +776,27 @@ func (p *JsonApiReceiver) toDeliveries(req *gohttp.Request) (deliveries []spirit
 	return
 }
 
+func (p *JsonApiReceiver) readJsonBody(req *gohttp.Request) (body []byte, err error) {
+	bodyReader := newLimitedReader(req.Body, p.conf.MaxBodySize)
+
+	if body, err = ioutil.ReadAll(bodyReader); err != nil {
+		if bodyReader.Exceeded() {
+			err = ErrRequestBodyTooLarge.New(errors.Params{"limit": p.conf.MaxBodySize})
+		}
+		return
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if p.conf.EmptyBody == EmptyBodyReject {
+			err = ErrRequestBodyIsEmpty.New()
+			return
+		}
+		body = []byte("{}")
+	}
+
+	return
+}
+
 func (p *JsonApiReceiver) deliveryToApiResponse(delivery spirit.Delivery) (resp APIResponse) {
 
 	var apiResp APIResponse
@@ -491,6 +844,157 @@ func (p *JsonApiReceiver) deliveryToApiResponse(delivery spirit.Delivery) (resp
 	return
 }
 
+// deliveryToForwardedApiResponse keeps the full payload state as result,
+// so the chained services could continue with the context and errors
+func (p *JsonApiReceiver) deliveryToForwardedApiResponse(delivery spirit.Delivery) (resp APIResponse) {
+	resp = p.deliveryToApiResponse(delivery)
+
+	payload := delivery.Payload()
+
+	data, _ := payload.GetData()
+
+	resp.Result = JsonPayload{
+		Id:      payload.Id(),
+		Data:    data,
+		Errors:  payload.Errors(),
+		Context: payload.Context(),
+	}
+
+	return
+}
+
+func (p *JsonApiReceiver) errorToApiResponse(err error) (apiResponse APIResponse) {
+	switch errCode := err.(type) {
+	case *SchemaValidationError:
+		{
+			apiResponse = APIResponse{
+				Code:           errCode.Code(),
+				ErrorId:        errCode.Id(),
+				ErrorNamespace: errCode.Namespace(),
+				Message:        errCode.Error(),
+				Result:         errCode.Fields,
+			}
+		}
+	case errors.ErrCode:
+		{
+			apiResponse = APIResponse{
+				Code:           errCode.Code(),
+				ErrorId:        errCode.Id(),
+				ErrorNamespace: errCode.Namespace(),
+				Message:        errCode.Error(),
+				Result:         nil,
+			}
+		}
+	default:
+		e := ErrApiGenericError.New().Append(err)
+		apiResponse = APIResponse{
+			Code:           e.Code(),
+			ErrorId:        e.Id(),
+			ErrorNamespace: e.Namespace(),
+			Message:        e.Error(),
+			Result:         nil,
+		}
+	}
+
+	return
+}
+
+func (p *JsonApiReceiver) writeErrorResponse(err error, res gohttp.ResponseWriter, req *gohttp.Request) {
+	apiResponse := p.errorToApiResponse(err)
+
+	if rateLimitErr, ok := err.(*RateLimitError); ok {
+		res.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rateLimitErr.RetryAfter.Seconds()))))
+	}
+
+	if data, e := json.Marshal(apiResponse); e != nil {
+		spirit.Logger().
+			WithField("event", "to deliveries").
+			WithField("urn", p.URN()).
+			WithField("name", p.Name()).
+			Errorln(err)
+	} else {
+		p.writeResponseWithStatusCode(data, res, req, p.conf.StatusCode.StatusCode(apiResponse))
+	}
+}
+
+// renderAndWriteResponse renders api responses to json response
+// normal response: {"code": 0, "message": "", "result": null}
+// error response: {"code": 212, "error_namespace": "xxxx", "message": "something wrong", "result": null}
+func (p *JsonApiReceiver) renderAndWriteResponse(isMultiCall bool, apiResponse map[string]APIResponse, res gohttp.ResponseWriter, req *gohttp.Request) (renderErr error) {
+	span := p.tracer.StartSpan(SpanRender, req)
+	defer p.tracer.EndSpan(span, nil)
+
+	if renderedData, e := p.rendererReloader.Renderer().Render(isMultiCall, apiResponse); e != nil {
+		p.metrics.IncRenderFailures()
+		span.SetAttribute("error", e.Error())
+
+		renderErr = e
+
+		err := ErrRenderApiDataFailed.New(errors.Params{"err": e})
+		resp := APIResponse{
+			Code:           err.Code(),
+			ErrorId:        err.Id(),
+			ErrorNamespace: err.Namespace(),
+			Message:        err.Error(),
+			Result:         nil,
+		}
+
+		if errRespData, e := json.Marshal(resp); e != nil {
+			strInternalErr := `{"code": 500, "message": "api server internal error", "result": null}`
+			p.writeResponseWithStatusCode([]byte(strInternalErr), res, req, gohttp.StatusInternalServerError)
+		} else {
+			p.writeResponseWithStatusCode(errRespData, res, req, p.conf.StatusCode.StatusCode(resp))
+		}
+	} else {
+		statusCode := gohttp.StatusOK
+		if isMultiCall {
+			statusCode = p.conf.StatusCode.MultiCallStatusCode(apiResponse)
+		} else {
+			for _, resp := range apiResponse {
+				statusCode = p.conf.StatusCode.StatusCode(resp)
+			}
+		}
+
+		p.writeResponseWithStatusCode(renderedData, res, req, statusCode)
+	}
+
+	return
+}
+
+// writeForwardedMultiCallResponse writes the envelope without templates, the
+// forwarded response is for services rather than the end users
+func (p *JsonApiReceiver) writeForwardedMultiCallResponse(apiResponse map[string]APIResponse, res gohttp.ResponseWriter, req *gohttp.Request) {
+	data, err := json.Marshal(APIResponse{
+		Code:    0,
+		Message: "",
+		Result:  apiResponse,
+	})
+
+	if err != nil {
+		p.metrics.IncRenderFailures()
+		p.writeErrorResponse(ErrRenderApiDataFailed.New(errors.Params{"err": err}), res, req)
+		return
+	}
+
+	p.writeResponseWithStatusCode(data, res, req, p.conf.StatusCode.MultiCallStatusCode(apiResponse))
+}
+
+// writeForwardedResponse writes the response of the single forwarded call
+// without templates, the result is the updated payload
+func (p *JsonApiReceiver) writeForwardedResponse(apiResponse map[string]APIResponse, res gohttp.ResponseWriter, req *gohttp.Request) {
+	for _, resp := range apiResponse {
+		data, err := json.Marshal(resp)
+		if err != nil {
+			p.metrics.IncRenderFailures()
+			p.writeErrorResponse(ErrRenderApiDataFailed.New(errors.Params{"err": err}), res, req)
+			return
+		}
+
+		p.writeResponseWithStatusCode(data, res, req, p.conf.StatusCode.StatusCode(resp))
+		return
+	}
+}
+
 func (p *JsonApiReceiver) writeResponse(data []byte, w gohttp.ResponseWriter, r *gohttp.Request) {
 	p.writeResponseWithStatusCode(data, w, r, gohttp.StatusOK)
 }
@@ -0,0 +1,297 @@
+package http_json_api
+
+import (
+	"encoding/json"
+	gohttp "net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJsonBody(t *testing.T) {
+	cases := []struct {
+		name         string
+		body         string
+		expectOffset int64 // -1 if no error expected
+	}{
+		{"object", `{"id":1}`, -1},
+		{"null", `null`, 0},
+		{"null with spaces", ` null `, 0},
+		{"syntax error", `{"id":}`, 7},
+		{"type error", `[1,2]`, 1},
+		{"empty", ``, 0},
+	}
+
+	for _, c := range cases {
+		v := map[string]interface{}{}
+
+		err := decodeJsonBody([]byte(c.body), &v)
+		if (err != nil) != (c.expectOffset >= 0) {
+			t.Errorf("%s: expect error %v, got %v", c.name, c.expectOffset >= 0, err)
+			continue
+		}
+
+		if err == nil {
+			continue
+		}
+
+		if !ErrMalformedJsonBody.IsEqual(err) {
+			t.Errorf("%s: expect malformed json body error, got %v", c.name, err)
+		}
+
+		if offset := "offset: " + strconv.FormatInt(c.expectOffset, 10); !strings.Contains(err.Error(), offset) {
+			t.Errorf("%s: expect %s, got %v", c.name, offset, err)
+		}
+	}
+}
+
+func TestToDeliveries(t *testing.T) {
+	type expectCall struct {
+		api  string
+		data string
+	}
+
+	cases := []struct {
+		name        string
+		method      string
+		path        string
+		headers     map[string]string
+		body        string
+		expectCalls map[string]expectCall
+		expectErr   bool
+
+		// the correlation id of payloads, the request header by default
+		correlationId string
+	}{
+		{
+			name:        "single call by path",
+			method:      "POST",
+			path:        "/order.get",
+			body:        `{"id":1}`,
+			expectCalls: map[string]expectCall{"order.get": {"order.get", `{"id":1}`}},
+		},
+		{
+			name:        "single call by header",
+			method:      "POST",
+			path:        "/",
+			headers:     map[string]string{DefaultApiHeader: "order.get"},
+			body:        `{"id":1}`,
+			expectCalls: map[string]expectCall{"order.get": {"order.get", `{"id":1}`}},
+		},
+		{
+			name:        "single call by query",
+			method:      "GET",
+			path:        "/order.get?id=1",
+			expectCalls: map[string]expectCall{"order.get": {"order.get", `{"id":1}`}},
+		},
+		{
+			name:      "single call without api name",
+			method:    "POST",
+			path:      "/",
+			body:      `{"id":1}`,
+			expectErr: true,
+		},
+		{
+			name:      "single call with malformed body",
+			method:    "POST",
+			path:      "/order.get",
+			body:      `{"id":`,
+			expectErr: true,
+		},
+		{
+			name:    "multi call",
+			method:  "POST",
+			path:    "/",
+			headers: map[string]string{DefaultApiMultiCallHeader: "1"},
+			body:    `{"order.get":{"id":1},"user":{"$api":"user.get","$data":{"id":2}}}`,
+			expectCalls: map[string]expectCall{
+				"order.get": {"order.get", `{"id":1}`},
+				"user":      {"user.get", `{"id":2}`},
+			},
+		},
+		{
+			name:      "multi call with get",
+			method:    "GET",
+			path:      "/",
+			headers:   map[string]string{DefaultApiMultiCallHeader: "1"},
+			expectErr: true,
+		},
+		{
+			name:    "forwarded single call",
+			method:  "POST",
+			path:    "/order.get",
+			headers: map[string]string{HeaderForwardedPayload: "1"},
+			body:    `{"id":"p1","data":{"id":1},"context":{"` + CtxHttpCorrelationId + `":"c1"}}`,
+			expectCalls: map[string]expectCall{
+				"order.get": {"order.get", `{"id":1}`},
+			},
+			correlationId: "c1",
+		},
+		{
+			name:    "forwarded multi call",
+			method:  "POST",
+			path:    "/",
+			headers: map[string]string{HeaderForwardedPayload: "1", DefaultApiMultiCallHeader: "1"},
+			body:    `{"order.get":{"id":"p1","data":{"id":1}},"user":{"$api":"user.get","$data":{"id":"p2","data":{"id":2}}}}`,
+			expectCalls: map[string]expectCall{
+				"order.get": {"order.get", `{"id":1}`},
+				"user":      {"user.get", `{"id":2}`},
+			},
+		},
+		{
+			name:      "forwarded multi call with malformed call",
+			method:    "POST",
+			path:      "/",
+			headers:   map[string]string{HeaderForwardedPayload: "1", DefaultApiMultiCallHeader: "1"},
+			body:      `{"order.get":[1]}`,
+			expectErr: true,
+		},
+	}
+
+	conf := JsonApiReceiverConfig{
+		BindURN:    "urn:test",
+		GetRequest: GetRequestConfig{Enabled: true, Apis: []string{"order.get"}},
+	}
+
+	receiver := newFormTestReceiver(t, conf)
+
+	for _, c := range cases {
+		req, _ := gohttp.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		req.Header.Set(DefaultCorrelationIdHeader, "c0")
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+
+		deliveries, apiIds, err := receiver.toDeliveries(req)
+		if (err != nil) != c.expectErr {
+			t.Errorf("%s: expect error %v, got %v", c.name, c.expectErr, err)
+			continue
+		}
+
+		if len(deliveries) != len(c.expectCalls) {
+			t.Errorf("%s: expect %d deliveries, got %d", c.name, len(c.expectCalls), len(deliveries))
+			continue
+		}
+
+		for _, delivery := range deliveries {
+			callName := apiIds[delivery.Id()]
+
+			expect, exist := c.expectCalls[callName]
+			if !exist {
+				t.Errorf("%s: unexpected call %q", c.name, callName)
+				continue
+			}
+
+			if apiName := delivery.(*HttpJsonApiDelivery).apiName; apiName != expect.api {
+				t.Errorf("%s: expect api of %q is %q, got %q", c.name, callName, expect.api, apiName)
+			}
+
+			data, _ := delivery.Payload().GetData()
+			if bData, _ := json.Marshal(data); string(bData) != expect.data {
+				t.Errorf("%s: expect data of %q is %s, got %s", c.name, callName, expect.data, bData)
+			}
+
+			expectCorrelationId := c.correlationId
+			if expectCorrelationId == "" {
+				expectCorrelationId = "c0"
+			}
+
+			if correlationId, _ := delivery.Payload().GetContext(CtxHttpCorrelationId); correlationId != expectCorrelationId {
+				t.Errorf("%s: expect correlation id %q, got %v", c.name, expectCorrelationId, correlationId)
+			}
+		}
+	}
+}
+
+func TestToDeliveriesForgedForwardedAuth(t *testing.T) {
+	receiver := newFormTestReceiver(t, JsonApiReceiverConfig{BindURN: "urn:test"})
+
+	body := `{"id":"p1","data":{"id":1},"context":{"` + CtxHttpAuth + `":{"verifier":"jwt","principal":"admin"}}}`
+
+	req, _ := gohttp.NewRequest("POST", "/order.get", strings.NewReader(body))
+	req.Header.Set(HeaderForwardedPayload, "1")
+
+	deliveries, _, err := receiver.toDeliveries(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if auth, exist := deliveries[0].Payload().GetContext(CtxHttpAuth); exist {
+		t.Errorf("expect the forged auth context removed, got %v", auth)
+	}
+}
+
+func TestToDeliveriesBody(t *testing.T) {
+	single := map[string]string{}
+	multi := map[string]string{DefaultApiMultiCallHeader: "1"}
+	forwarded := map[string]string{HeaderForwardedPayload: "1"}
+
+	large := `{"name":"` + strings.Repeat("a", 64) + `"}`
+
+	cases := []struct {
+		name      string
+		headers   map[string]string
+		body      string
+		conf      JsonApiReceiverConfig
+		expectErr interface {
+			IsEqual(error) bool
+		}
+		expectDeliveries int
+		expectData       string
+	}{
+		{"single too large", single, large, JsonApiReceiverConfig{MaxBodySize: 32}, ErrRequestBodyTooLarge, 0, ""},
+		{"multi too large", multi, `{"order.get":` + large + `}`, JsonApiReceiverConfig{MaxBodySize: 32}, ErrRequestBodyTooLarge, 0, ""},
+		{"forwarded too large", forwarded, `{"data":` + large + `}`, JsonApiReceiverConfig{MaxBodySize: 32}, ErrRequestBodyTooLarge, 0, ""},
+		{"single under limit", single, `{"id":1}`, JsonApiReceiverConfig{MaxBodySize: 32}, nil, 1, `{"id":1}`},
+		{"single empty rejected", single, " ", JsonApiReceiverConfig{EmptyBody: EmptyBodyReject}, ErrRequestBodyIsEmpty, 0, ""},
+		{"multi empty rejected", multi, "", JsonApiReceiverConfig{EmptyBody: EmptyBodyReject}, ErrRequestBodyIsEmpty, 0, ""},
+		{"forwarded empty rejected", forwarded, "", JsonApiReceiverConfig{EmptyBody: EmptyBodyReject}, ErrRequestBodyIsEmpty, 0, ""},
+		{"single empty as object", single, " ", JsonApiReceiverConfig{}, nil, 1, `{}`},
+		{"multi empty as object", multi, "", JsonApiReceiverConfig{}, nil, 0, ""},
+		{"forwarded empty as object", forwarded, "", JsonApiReceiverConfig{}, nil, 1, `null`},
+		{"single null", single, "null", JsonApiReceiverConfig{}, ErrMalformedJsonBody, 0, ""},
+	}
+
+	for _, c := range cases {
+		c.conf.BindURN = "urn:test"
+		receiver := newFormTestReceiver(t, c.conf)
+
+		path := "/order.get"
+		if c.headers[DefaultApiMultiCallHeader] != "" {
+			path = "/"
+		}
+
+		req, _ := gohttp.NewRequest("POST", path, strings.NewReader(c.body))
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+
+		deliveries, _, err := receiver.toDeliveries(req)
+
+		if c.expectErr != nil {
+			if !c.expectErr.IsEqual(err) {
+				t.Errorf("%s: expect error %v, got %v", c.name, c.expectErr, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: expect no error, got %v", c.name, err)
+			continue
+		}
+
+		if len(deliveries) != c.expectDeliveries {
+			t.Errorf("%s: expect %d deliveries, got %d", c.name, c.expectDeliveries, len(deliveries))
+			continue
+		}
+
+		// the empty body is the empty object, which is the empty payload of
+		// forwarded call
+		if c.expectData != "" {
+			data, _ := deliveries[0].Payload().GetData()
+			if bData, _ := json.Marshal(data); string(bData) != c.expectData {
+				t.Errorf("%s: expect data %s, got %s", c.name, c.expectData, bData)
+			}
+		}
+	}
+}
@@ -12,6 +12,10 @@ import (
 	"github.com/gogap/errors"
 )
 
+const (
+	internalDefaultTemplate = "_internal/default"
+)
+
 type APIResponse struct {
 	Code           uint64      `json:"code"`
 	ErrorId        string      `json:"error_id,omitempty"`
@@ -42,7 +46,7 @@ func NewAPIResponseRenderer() *APIResponseRenderer {
 	renderer := &APIResponseRenderer{
 		Template:        *template.New(""),
 		apiTemplate:     make(map[string]string),
-		defaultTemplate: "_internal/default",
+		defaultTemplate: internalDefaultTemplate,
 		Variables:       make(map[string]interface{}),
 	}
 
@@ -55,6 +59,36 @@ func NewAPIResponseRenderer() *APIResponseRenderer {
 	return renderer
 }
 
+func NewAPIResponseRendererWithConfig(conf RendererConfig) (renderer *APIResponseRenderer, err error) {
+	tmpRenderer := NewAPIResponseRenderer()
+
+	if err = tmpRenderer.LoadTemplates(conf.Templates...); err != nil {
+		err = ErrLoadTemplatesFailed.New(errors.Params{"paths": strings.Join(conf.Templates, ",")}).Append(err)
+		return
+	}
+
+	if err = tmpRenderer.LoadVariables(conf.Variables...); err != nil {
+		err = ErrLoadVariablesFailed.New(errors.Params{"paths": strings.Join(conf.Variables, ",")}).Append(err)
+		return
+	}
+
+	if err = tmpRenderer.SetDefaultTemplate(conf.DefaultTemplate); err != nil {
+		return
+	}
+
+	for tmplName, apiNames := range conf.Relation {
+		for _, apiName := range apiNames {
+			if err = tmpRenderer.SetAPITemplate(apiName, tmplName); err != nil {
+				return
+			}
+		}
+	}
+
+	renderer = tmpRenderer
+
+	return
+}
+
 func (p *APIResponseRenderer) LoadTemplates(paths ...string) (err error) {
 	if paths == nil {
 		return
@@ -148,7 +182,7 @@ func (p *APIResponseRenderer) LoadVariables(paths ...string) (err error) {
 			}
 		} else {
 			var matches []string
-			if matches, err = filepath.Glob("*.tmpl"); err != nil {
+			if matches, err = filepath.Glob(filepath.Join(path, "*.json")); err != nil {
 				return
 			}
 
@@ -158,7 +192,7 @@ func (p *APIResponseRenderer) LoadVariables(paths ...string) (err error) {
 					return
 				}
 
-				if err = appendVarsFunc(relPath, filepath.Join(path, file)); err != nil {
+				if err = appendVarsFunc(relPath, file); err != nil {
 					return
 				}
 			}
@@ -171,7 +205,7 @@ func (p *APIResponseRenderer) LoadVariables(paths ...string) (err error) {
 func (p *APIResponseRenderer) SetDefaultTemplate(name string) (err error) {
 	name = strings.TrimSpace(name)
 	if name == "" {
-		p.defaultTemplate = "_internal/default"
+		p.defaultTemplate = internalDefaultTemplate
 		return
 	}
 
@@ -223,34 +257,66 @@ func (p *APIResponseRenderer) AddTemplate(name, tpl string) (err error) {
 
 func (p *APIResponseRenderer) Render(isMulti bool, response map[string]APIResponse) (renderedData []byte, err error) {
 	output := map[string]string{}
+	nativeOutput := map[string]json.RawMessage{}
 
 	for api, response := range response {
 
-		renderData := RenderData{
-			API: APIRenderData{
-				false,
-				api,
-				response,
-			},
-			Vars: p.Variables,
-		}
-
 		tmplName := p.defaultTemplate
 		if name, exist := p.apiTemplate[api]; exist {
 			tmplName = name
 		}
 
-		var buf bytes.Buffer
-		if err = p.ExecuteTemplate(&buf, tmplName, renderData); err != nil {
-			return
+		var data []byte
+
+		if tmplName == internalDefaultTemplate {
+			if data, err = json.Marshal(response); err != nil {
+				return
+			}
+		} else {
+			renderData := RenderData{
+				API: APIRenderData{
+					false,
+					api,
+					response,
+				},
+				Vars: p.Variables,
+			}
+
+			var buf bytes.Buffer
+			if err = p.ExecuteTemplate(&buf, tmplName, renderData); err != nil {
+				return
+			}
+
+			data = buf.Bytes()
 		}
 
 		if !isMulti {
-			renderedData = buf.Bytes()
+			renderedData = data
 			return
 		}
 
-		output[api] = buf.String()
+		output[api] = string(data)
+		nativeOutput[api] = json.RawMessage(data)
+	}
+
+	// the default envelope of multi call is encoded natively if the rendered
+	// output of each api is a valid json value, otherwise the outputs are
+	// joined by the default template
+	isNative := p.defaultTemplate == internalDefaultTemplate
+	for _, data := range nativeOutput {
+		if !json.Valid(data) {
+			isNative = false
+			break
+		}
+	}
+
+	if isNative {
+		renderedData, err = json.Marshal(APIResponse{
+			Code:    0,
+			Message: "",
+			Result:  nativeOutput,
+		})
+		return
 	}
 
 	var buf bytes.Buffer
@@ -279,6 +345,37 @@ func (p *APIResponseRenderer) Render(isMulti bool, response map[string]APIRespon
 	return
 }
 
+func (p *APIResponseRenderer) Validate() (err error) {
+	sampleResponses := []APIResponse{
+		{Code: 0, Message: "", Result: map[string]interface{}{"id": "sample"}},
+		{Code: 500, ErrorId: "sample", ErrorNamespace: HttpJsonApiErrNamespace, Message: "sample error", Result: nil},
+	}
+
+	apiNames := []string{""}
+	for apiName := range p.apiTemplate {
+		apiNames = append(apiNames, apiName)
+	}
+
+	for _, sample := range sampleResponses {
+		multiResponse := map[string]APIResponse{}
+
+		for _, apiName := range apiNames {
+			if _, err = p.Render(false, map[string]APIResponse{apiName: sample}); err != nil {
+				err = ErrValidateTemplateFailed.New(errors.Params{"apiName": apiName}).Append(err)
+				return
+			}
+			multiResponse[apiName] = sample
+		}
+
+		if _, err = p.Render(true, multiResponse); err != nil {
+			err = ErrValidateTemplateFailed.New(errors.Params{"apiName": "multi-call"}).Append(err)
+			return
+		}
+	}
+
+	return
+}
+
 func (p *APIResponseRenderer) appendVars(vars map[string]interface{}) (err error) {
 	for k, v := range vars {
 		if original, exist := p.Variables[k]; exist {
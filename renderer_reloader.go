@@ -0,0 +1,203 @@
+package http_json_api
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogap/spirit"
+)
+
+type APIResponseRendererReloader struct {
+	conf     RendererConfig
+	renderer atomic.Value
+
+	fingerprint  string
+	reloadLocker sync.Mutex
+
+	lastErr     error
+	errorLocker sync.RWMutex
+
+	stopChan  chan bool
+	isRunning bool
+
+	statusLocker sync.Mutex
+}
+
+func NewAPIResponseRendererReloader(conf RendererConfig) (reloader *APIResponseRendererReloader, err error) {
+	tmpReloader := &APIResponseRendererReloader{
+		conf: conf,
+	}
+
+	if err = tmpReloader.Reload(); err != nil {
+		return
+	}
+
+	reloader = tmpReloader
+
+	return
+}
+
+func (p *APIResponseRendererReloader) Renderer() *APIResponseRenderer {
+	return p.renderer.Load().(*APIResponseRenderer)
+}
+
+// Reload builds a fresh renderer from config and swaps it in only if all of
+// the related templates could render a sample response
+func (p *APIResponseRendererReloader) Reload() (err error) {
+	p.reloadLocker.Lock()
+	defer p.reloadLocker.Unlock()
+
+	return p.reload(p.currentFingerprint())
+}
+
+// LastReloadError returns the error of the last reload, it is nil once the
+// renderer reloaded successfully
+func (p *APIResponseRendererReloader) LastReloadError() error {
+	p.errorLocker.RLock()
+	defer p.errorLocker.RUnlock()
+
+	return p.lastErr
+}
+
+func (p *APIResponseRendererReloader) reload(fingerprint string) (err error) {
+	defer func() {
+		p.errorLocker.Lock()
+		p.lastErr = err
+		p.errorLocker.Unlock()
+	}()
+
+	var renderer *APIResponseRenderer
+	if renderer, err = NewAPIResponseRendererWithConfig(p.conf); err != nil {
+		return
+	}
+
+	if err = renderer.Validate(); err != nil {
+		return
+	}
+
+	p.renderer.Store(renderer)
+	p.fingerprint = fingerprint
+
+	return
+}
+
+func (p *APIResponseRendererReloader) Start() {
+	p.statusLocker.Lock()
+	defer p.statusLocker.Unlock()
+
+	if p.isRunning || !p.conf.Reload {
+		return
+	}
+
+	p.stopChan = make(chan bool)
+	p.isRunning = true
+
+	go p.watch(p.stopChan)
+}
+
+func (p *APIResponseRendererReloader) Stop() {
+	p.statusLocker.Lock()
+	defer p.statusLocker.Unlock()
+
+	if !p.isRunning {
+		return
+	}
+
+	close(p.stopChan)
+	p.isRunning = false
+}
+
+func (p *APIResponseRendererReloader) watch(stopChan chan bool) {
+	interval := time.Duration(p.conf.ReloadInterval) * time.Millisecond
+
+	if interval <= 0 {
+		interval = DefaultRendererReloadInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			{
+				p.reloadIfChanged()
+			}
+		case <-stopChan:
+			{
+				return
+			}
+		}
+	}
+}
+
+func (p *APIResponseRendererReloader) reloadIfChanged() {
+	p.reloadLocker.Lock()
+	defer p.reloadLocker.Unlock()
+
+	fingerprint := p.currentFingerprint()
+	if fingerprint == p.fingerprint {
+		return
+	}
+
+	if err := p.reload(fingerprint); err != nil {
+		// remember the broken files state, the old renderer keeps serving until they are changed again
+		p.fingerprint = fingerprint
+
+		spirit.Logger().
+			WithField("event", "reload renderer").
+			WithField("templates", p.conf.Templates).
+			WithField("variables", p.conf.Variables).
+			Errorln(err)
+		return
+	}
+
+	spirit.Logger().
+		WithField("event", "reload renderer").
+		WithField("templates", p.conf.Templates).
+		WithField("variables", p.conf.Variables).
+		Infoln("renderer reloaded")
+}
+
+func (p *APIResponseRendererReloader) currentFingerprint() string {
+	states := []string{}
+
+	fileStatesFunc := func(paths []string, pattern string) {
+		for _, path := range paths {
+			var fi os.FileInfo
+			var err error
+
+			if fi, err = os.Stat(path); err != nil {
+				states = append(states, path+":"+err.Error())
+				continue
+			}
+
+			states = append(states, fileState(path, fi))
+
+			if !fi.IsDir() {
+				continue
+			}
+
+			matches, _ := filepath.Glob(filepath.Join(path, pattern))
+			for _, file := range matches {
+				if fi, err = os.Stat(file); err == nil {
+					states = append(states, fileState(file, fi))
+				}
+			}
+		}
+	}
+
+	fileStatesFunc(p.conf.Templates, "*.tmpl")
+	fileStatesFunc(p.conf.Variables, "*.json")
+
+	return strings.Join(states, ";")
+}
+
+func fileState(path string, fi os.FileInfo) string {
+	return path + ":" + strconv.FormatInt(fi.ModTime().UnixNano(), 10) + ":" + strconv.FormatInt(fi.Size(), 10)
+}
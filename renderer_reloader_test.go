@@ -0,0 +1,79 @@
+package http_json_api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRendererReloaderKeepsRendererOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	tmplFile := filepath.Join(dir, "order.tmpl")
+
+	modTime := time.Now()
+
+	writeTemplate := func(content string) {
+		if err := ioutil.WriteFile(tmplFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// make sure the fingerprint changed even within the mtime resolution
+		modTime = modTime.Add(time.Second)
+		if err := os.Chtimes(tmplFile, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeTemplate(`v1 {{.API.Response.Message}}`)
+
+	reloader, err := NewAPIResponseRendererReloader(RendererConfig{
+		Templates: []string{dir},
+		Relation:  map[string][]string{"order.tmpl": {"order.get"}},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectOutput := func(step string, expect string) {
+		data, err := reloader.Renderer().Render(false, map[string]APIResponse{"order.get": {Message: "ok"}})
+		if err != nil {
+			t.Fatalf("%s: %s", step, err)
+		}
+
+		if string(data) != expect {
+			t.Errorf("%s: expect %q, got %q", step, expect, data)
+		}
+	}
+
+	expectOutput("initial", "v1 ok")
+
+	steps := []struct {
+		name      string
+		template  string
+		reload    func() error
+		expectErr bool
+		expect    string
+	}{
+		{"parse failed", `v2 {{.API.Response.Message`, reloader.Reload, true, "v1 ok"},
+		{"validate failed on watch", `v2 {{template "not_exist"}}`, func() error { reloader.reloadIfChanged(); return reloader.LastReloadError() }, true, "v1 ok"},
+		{"recovered", `v3 {{.API.Response.Message}}`, reloader.Reload, false, "v3 ok"},
+	}
+
+	for _, step := range steps {
+		writeTemplate(step.template)
+
+		err := step.reload()
+		if (err != nil) != step.expectErr {
+			t.Errorf("%s: expect reload error %v, got %v", step.name, step.expectErr, err)
+		}
+
+		if reloader.LastReloadError() != err {
+			t.Errorf("%s: expect last reload error %v, got %v", step.name, err, reloader.LastReloadError())
+		}
+
+		expectOutput(step.name, step.expect)
+	}
+}
@@ -0,0 +1,135 @@
+package http_json_api
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var benchRenderResult = map[string]interface{}{
+	"id":    1001,
+	"name":  "order",
+	"items": []interface{}{"a", "b", "c"},
+	"extra": map[string]interface{}{"paid": true, "amount": 99.5},
+}
+
+func newBenchRenderer(b *testing.B, isTemplate bool) *APIResponseRenderer {
+	renderer := NewAPIResponseRenderer()
+
+	if !isTemplate {
+		return renderer
+	}
+
+	// the same template as the internal default, rendered by template engine
+	if err := renderer.AddTemplate(defaultAPITemplate()); err != nil {
+		b.Fatal(err)
+	}
+
+	if err := renderer.SetDefaultTemplate("default"); err != nil {
+		b.Fatal(err)
+	}
+
+	return renderer
+}
+
+func newBenchResponses(size int) map[string]APIResponse {
+	responses := map[string]APIResponse{}
+	for i := 0; i < size; i++ {
+		responses["order"+strconv.Itoa(i)] = APIResponse{Result: benchRenderResult}
+	}
+	return responses
+}
+
+func benchmarkRender(b *testing.B, isTemplate bool, isMulti bool, size int) {
+	renderer := newBenchRenderer(b, isTemplate)
+	responses := newBenchResponses(size)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := renderer.Render(isMulti, responses); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRenderSingleNative(b *testing.B) {
+	benchmarkRender(b, false, false, 1)
+}
+
+func BenchmarkRenderMultiNative(b *testing.B) {
+	benchmarkRender(b, false, true, 10)
+}
+
+func BenchmarkRenderSingleTemplate(b *testing.B) {
+	benchmarkRender(b, true, false, 1)
+}
+
+func BenchmarkRenderMultiTemplate(b *testing.B) {
+	benchmarkRender(b, true, true, 10)
+}
+
+func TestRenderNativeEscaping(t *testing.T) {
+	renderer := NewAPIResponseRenderer()
+
+	message := "say \"hi\"\nthen </script><script>alert(1)</script>"
+
+	responses := map[string]APIResponse{
+		"order.get": {Code: 1001, ErrorNamespace: "ORDER", Message: message, Result: map[string]interface{}{"note": message}},
+	}
+
+	for _, isMulti := range []bool{false, true} {
+		data, err := renderer.Render(isMulti, responses)
+		if err != nil {
+			t.Fatalf("multi %v: %s", isMulti, err)
+		}
+
+		if !json.Valid(data) {
+			t.Fatalf("multi %v: expect valid json, got %s", isMulti, data)
+		}
+
+		if strings.Contains(string(data), "</script>") {
+			t.Errorf("multi %v: expect html characters escaped, got %s", isMulti, data)
+		}
+
+		resp := APIResponse{}
+		json.Unmarshal(data, &resp)
+
+		if isMulti {
+			results, _ := resp.Result.(map[string]interface{})
+			result, _ := results["order.get"].(map[string]interface{})
+			if result["message"] != message {
+				t.Errorf("multi %v: expect message kept, got %s", isMulti, data)
+			}
+		} else if resp.Message != message {
+			t.Errorf("multi %v: expect message kept, got %s", isMulti, data)
+		}
+	}
+}
+
+func TestRenderMultiNativeWithNonJsonTemplate(t *testing.T) {
+	renderer := NewAPIResponseRenderer()
+
+	if err := renderer.AddTemplate("plain", "{{.API.Response.Message}}"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := renderer.SetAPITemplate("order.text", "plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := renderer.Render(true, map[string]APIResponse{
+		"order.get":  {Result: "ok"},
+		"order.text": {Message: "hello"},
+	})
+
+	if err != nil {
+		t.Fatalf("expect the outputs joined by template, got %s", err)
+	}
+
+	if !strings.Contains(string(data), `"order.text":hello`) || !strings.Contains(string(data), `"order.get":{"code":0`) {
+		t.Errorf("expect the outputs of apis joined, got %s", data)
+	}
+}
@@ -0,0 +1,319 @@
+package http_json_api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	gohttp "net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gogap/errors"
+	"github.com/gogap/spirit"
+)
+
+const (
+	ResponseCacheStoreMemory = "memory"
+)
+
+var (
+	DefaultResponseCacheTTL      = time.Minute
+	DefaultResponseCacheCapacity = 10000
+)
+
+// ResponseCacheRule caches the successful responses of api in ttl, the cache
+// key is the api data, the request headers and the authenticated principal
+type ResponseCacheRule struct {
+	TTL     int      `json:"ttl"` // seconds
+	Headers []string `json:"headers"`
+	Public  bool     `json:"public"`
+}
+
+type ResponseCacheConfig struct {
+	Apis map[string]ResponseCacheRule `json:"apis"`
+
+	Store        string     `json:"store"`
+	StoreOptions spirit.Map `json:"store_options"`
+}
+
+func (p *ResponseCacheConfig) initial() {
+	for apiName, rule := range p.Apis {
+		if rule.TTL <= 0 {
+			rule.TTL = int(DefaultResponseCacheTTL / time.Second)
+		}
+		p.Apis[apiName] = rule
+	}
+
+	if p.Store == "" {
+		p.Store = ResponseCacheStoreMemory
+	}
+}
+
+func (p *ResponseCacheConfig) IsEnabled() bool {
+	return len(p.Apis) > 0
+}
+
+type ResponseCacheEntry struct {
+	ETag       string    `json:"etag"`
+	StatusCode int       `json:"status_code"`
+	Body       []byte    `json:"body"`
+	ExpireAt   time.Time `json:"expire_at"`
+}
+
+type ResponseCacheStore interface {
+	// Get returns nil entry if the key not exist or expired
+	Get(key string) (entry *ResponseCacheEntry, err error)
+	Set(key string, entry ResponseCacheEntry, ttl time.Duration) (err error)
+}
+
+type NewResponseCacheStoreFunc func(options spirit.Map) (store ResponseCacheStore, err error)
+
+var responseCacheStores = map[string]NewResponseCacheStoreFunc{
+	ResponseCacheStoreMemory: func(options spirit.Map) (store ResponseCacheStore, err error) {
+		opts := struct {
+			Capacity int `json:"capacity"`
+		}{}
+
+		if err = options.ToObject(&opts); err != nil {
+			return
+		}
+
+		store = NewMemoryResponseCacheStore(opts.Capacity)
+
+		return
+	},
+}
+
+// RegisterResponseCacheStore registers the store could be used in response cache config
+func RegisterResponseCacheStore(name string, fn NewResponseCacheStoreFunc) {
+	responseCacheStores[name] = fn
+}
+
+func newResponseCacheStore(conf ResponseCacheConfig) (store ResponseCacheStore, err error) {
+	fn, exist := responseCacheStores[conf.Store]
+	if !exist {
+		err = ErrLoadResponseCacheStoreFailed.New(errors.Params{"store": conf.Store, "err": "store not exist"})
+		return
+	}
+
+	options := conf.StoreOptions
+	if options == nil {
+		options = spirit.Map{}
+	}
+
+	if store, err = fn(options); err != nil {
+		err = ErrLoadResponseCacheStoreFailed.New(errors.Params{"store": conf.Store, "err": err})
+		return
+	}
+
+	return
+}
+
+type cachedCall struct {
+	key    string
+	rule   ResponseCacheRule
+	entry  *ResponseCacheEntry
+	writer *cacheResponseWriter
+}
+
+// lookupResponseCache returns the cached call of the single non-forwarded
+// api call, the entry of call is nil if the response is not cached yet
+func (p *JsonApiReceiver) lookupResponseCache(req *gohttp.Request, deliveries []spirit.Delivery) (call *cachedCall) {
+	if p.responseCacheStore == nil || p.isMultiCall(req) || p.isForwarded(req) || len(deliveries) != 1 {
+		return
+	}
+
+	delivery, ok := deliveries[0].(*HttpJsonApiDelivery)
+	if !ok {
+		return
+	}
+
+	rule, exist := p.conf.ResponseCache.Apis[delivery.apiName]
+	if !exist {
+		return
+	}
+
+	payload := delivery.Payload()
+	data, _ := payload.GetData()
+
+	headers := map[string]string{}
+	for _, key := range rule.Headers {
+		headers[strings.ToLower(key)] = req.Header.Get(key)
+	}
+
+	// the responses of principals are not shared
+	principal := ""
+	if v, exist := payload.GetContext(CtxHttpAuth); exist {
+		if authPrincipal, ok := v.(*AuthPrincipal); ok {
+			principal = authPrincipal.Verifier + ":" + authPrincipal.Principal
+		}
+	}
+
+	// the keys of json map are sorted while marshaling
+	bKey, err := json.Marshal(map[string]interface{}{
+		"data":      data,
+		"headers":   headers,
+		"principal": principal,
+	})
+
+	if err != nil {
+		return
+	}
+
+	sum := sha256.Sum256(bKey)
+
+	call = &cachedCall{
+		key:  p.name + ":" + delivery.apiName + ":" + hex.EncodeToString(sum[:]),
+		rule: rule,
+	}
+
+	if call.entry, err = p.responseCacheStore.Get(call.key); err != nil {
+		spirit.Logger().
+			WithField("event", "get response cache").
+			WithField("urn", p.URN()).
+			WithField("name", p.Name()).
+			Errorln(err)
+	}
+
+	return
+}
+
+func (p *JsonApiReceiver) recordResponseCache(call *cachedCall, res gohttp.ResponseWriter) gohttp.ResponseWriter {
+	call.writer = &cacheResponseWriter{ResponseWriter: res}
+	return call.writer
+}
+
+// finishResponseCache writes the buffered response with cache headers, only
+// the succeeded responses written with status 200 are cached
+func (p *JsonApiReceiver) finishResponseCache(call *cachedCall, apiResponse map[string]APIResponse, req *gohttp.Request) {
+	statusCode := call.writer.statusCode
+	if statusCode == 0 {
+		statusCode = gohttp.StatusOK
+	}
+
+	body := call.writer.body.Bytes()
+
+	if statusCode != gohttp.StatusOK || !isApiResponseSucceeded(apiResponse) {
+		call.writer.ResponseWriter.WriteHeader(statusCode)
+		call.writer.ResponseWriter.Write(body)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	ttl := time.Duration(call.rule.TTL) * time.Second
+
+	entry := ResponseCacheEntry{
+		ETag:       `"` + hex.EncodeToString(sum[:16]) + `"`,
+		StatusCode: statusCode,
+		Body:       body,
+		ExpireAt:   time.Now().Add(ttl),
+	}
+
+	if err := p.responseCacheStore.Set(call.key, entry, ttl); err != nil {
+		spirit.Logger().
+			WithField("event", "set response cache").
+			WithField("urn", p.URN()).
+			WithField("name", p.Name()).
+			Errorln(err)
+	}
+
+	p.writeCacheEntry(call.rule, &entry, call.writer.ResponseWriter, req)
+}
+
+func (p *JsonApiReceiver) writeCachedResponse(call *cachedCall, access *accessLog, res gohttp.ResponseWriter, req *gohttp.Request, done chan<- bool) {
+	defer notifyDone(done)
+	defer p.observeUndispatchedResponse(access, APIResponse{})
+
+	p.writeAccessHeaders(res, req)
+	p.writeBasicHeaders(res, req)
+	res.Header().Set("Content-Type", "application/json")
+
+	p.writeCacheEntry(call.rule, call.entry, res, req)
+}
+
+func (p *JsonApiReceiver) writeCacheEntry(rule ResponseCacheRule, entry *ResponseCacheEntry, res gohttp.ResponseWriter, req *gohttp.Request) {
+	maxAge := int(entry.ExpireAt.Sub(time.Now()) / time.Second)
+	if maxAge < 0 {
+		maxAge = 0
+	}
+
+	visibility := "private"
+	if rule.Public {
+		visibility = "public"
+	}
+
+	res.Header().Set("ETag", entry.ETag)
+	res.Header().Set("Cache-Control", visibility+", max-age="+strconv.Itoa(maxAge))
+
+	if matchETag(req.Header.Get("If-None-Match"), entry.ETag) {
+		res.WriteHeader(gohttp.StatusNotModified)
+		return
+	}
+
+	res.WriteHeader(entry.StatusCode)
+	res.Write(entry.Body)
+}
+
+func matchETag(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cacheResponseWriter buffers the response, so the etag of body could be
+// written in headers
+type cacheResponseWriter struct {
+	gohttp.ResponseWriter
+
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (p *cacheResponseWriter) WriteHeader(statusCode int) {
+	p.statusCode = statusCode
+}
+
+func (p *cacheResponseWriter) Write(data []byte) (int, error) {
+	return p.body.Write(data)
+}
+
+// MemoryResponseCacheStore keeps the responses in process, the least
+// recently used responses are evicted once the capacity is reached
+type MemoryResponseCacheStore struct {
+	cache *lruCache
+}
+
+func NewMemoryResponseCacheStore(capacity int) *MemoryResponseCacheStore {
+	if capacity <= 0 {
+		capacity = DefaultResponseCacheCapacity
+	}
+
+	return &MemoryResponseCacheStore{
+		cache: newLRUCache(capacity),
+	}
+}
+
+func (p *MemoryResponseCacheStore) Get(key string) (entry *ResponseCacheEntry, err error) {
+	if v, exist := p.cache.Get(key); exist {
+		cachedEntry := v.(ResponseCacheEntry)
+		entry = &cachedEntry
+	}
+
+	return
+}
+
+func (p *MemoryResponseCacheStore) Set(key string, entry ResponseCacheEntry, ttl time.Duration) (err error) {
+	p.cache.Set(key, entry, ttl)
+	return
+}
@@ -0,0 +1,92 @@
+package http_json_api
+
+import (
+	gohttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryResponseCacheStore(t *testing.T) {
+	store := NewMemoryResponseCacheStore(10)
+
+	if entry, _ := store.Get("k"); entry != nil {
+		t.Fatalf("expect no entry, got %v", entry)
+	}
+
+	store.Set("k", ResponseCacheEntry{ETag: `"a"`, StatusCode: 200, Body: []byte("{}")}, time.Minute)
+
+	if entry, _ := store.Get("k"); entry == nil || entry.ETag != `"a"` {
+		t.Fatalf("expect the entry, got %v", entry)
+	}
+
+	store.Set("expired", ResponseCacheEntry{ETag: `"b"`}, time.Millisecond)
+	time.Sleep(time.Millisecond * 5)
+
+	if entry, _ := store.Get("expired"); entry != nil {
+		t.Errorf("expect the entry expired, got %v", entry)
+	}
+}
+
+func TestFinishResponseCache(t *testing.T) {
+	cases := []struct {
+		name         string
+		statusCode   int
+		apiResponse  map[string]APIResponse
+		expectCached bool
+	}{
+		{"succeeded", 200, map[string]APIResponse{"order.get": {Code: 0, Result: "ok"}}, true},
+		{"failed with status 200", 200, map[string]APIResponse{"order.get": {Code: 1001, ErrorNamespace: "ORDER"}}, false},
+		{"failed with status 404", 404, map[string]APIResponse{"order.get": {Code: 1001, ErrorNamespace: "ORDER"}}, false},
+		{"render failed", 500, map[string]APIResponse{"order.get": {Code: 0}}, false},
+	}
+
+	for _, c := range cases {
+		receiver := &JsonApiReceiver{responseCacheStore: NewMemoryResponseCacheStore(10)}
+
+		call := &cachedCall{key: "k", rule: ResponseCacheRule{TTL: 60}}
+
+		recorder := httptest.NewRecorder()
+
+		w := receiver.recordResponseCache(call, recorder)
+		w.WriteHeader(c.statusCode)
+		w.Write([]byte(`{"code":0}`))
+
+		req, _ := gohttp.NewRequest("GET", "/order.get", nil)
+		receiver.finishResponseCache(call, c.apiResponse, req)
+
+		entry, _ := receiver.responseCacheStore.Get(call.key)
+
+		if cached := entry != nil; cached != c.expectCached {
+			t.Errorf("%s: expect cached %v, got %v", c.name, c.expectCached, entry)
+		}
+
+		if recorder.Code != c.statusCode || recorder.Body.String() != `{"code":0}` {
+			t.Errorf("%s: expect the buffered response written, got %d %s", c.name, recorder.Code, recorder.Body.String())
+		}
+
+		if hasETag := recorder.Header().Get("ETag") != ""; hasETag != c.expectCached {
+			t.Errorf("%s: expect etag %v, got %q", c.name, c.expectCached, recorder.Header().Get("ETag"))
+		}
+	}
+}
+
+func TestMatchETag(t *testing.T) {
+	cases := []struct {
+		ifNoneMatch string
+		expect      bool
+	}{
+		{"", false},
+		{`"a"`, true},
+		{`W/"a"`, true},
+		{`"b", "a"`, true},
+		{`"b"`, false},
+		{"*", true},
+	}
+
+	for _, c := range cases {
+		if matched := matchETag(c.ifNoneMatch, `"a"`); matched != c.expect {
+			t.Errorf("matchETag(%q) = %v, expect %v", c.ifNoneMatch, matched, c.expect)
+		}
+	}
+}
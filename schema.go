@@ -0,0 +1,294 @@
+package http_json_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gogap/errors"
+)
+
+// JsonSchema is the subset of json schema (draft 4) used to validate the
+// payload data of apis: type, enum, properties, required,
+// additionalProperties, items and the basic numeric, string and array limits
+type JsonSchema struct {
+	Type                 interface{}            `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Properties           map[string]*JsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Items                *JsonSchema            `json:"items"`
+
+	Minimum          *float64 `json:"minimum"`
+	Maximum          *float64 `json:"maximum"`
+	ExclusiveMinimum bool     `json:"exclusiveMinimum"`
+	ExclusiveMaximum bool     `json:"exclusiveMaximum"`
+
+	MinLength *int   `json:"minLength"`
+	MaxLength *int   `json:"maxLength"`
+	Pattern   string `json:"pattern"`
+
+	MinItems *int `json:"minItems"`
+	MaxItems *int `json:"maxItems"`
+
+	types                []string
+	pattern              *regexp.Regexp
+	allowAdditional      bool
+	additionalProperties *JsonSchema
+}
+
+type SchemaFieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type SchemaValidationError struct {
+	errors.ErrCode
+	Fields []SchemaFieldError
+}
+
+// NewJsonSchema accepts an inline schema object or the path of a schema file
+func NewJsonSchema(v interface{}) (schema *JsonSchema, err error) {
+	var data []byte
+
+	switch d := v.(type) {
+	case string:
+		if data, err = ioutil.ReadFile(d); err != nil {
+			return
+		}
+	default:
+		if data, err = json.Marshal(d); err != nil {
+			return
+		}
+	}
+
+	tmpSchema := &JsonSchema{}
+	if err = json.Unmarshal(data, tmpSchema); err != nil {
+		return
+	}
+
+	if err = tmpSchema.compile(); err != nil {
+		return
+	}
+
+	schema = tmpSchema
+
+	return
+}
+
+func (p *JsonSchema) compile() (err error) {
+	switch t := p.Type.(type) {
+	case nil:
+	case string:
+		p.types = []string{t}
+	case []interface{}:
+		for _, v := range t {
+			if str, ok := v.(string); ok {
+				p.types = append(p.types, str)
+			} else {
+				return fmt.Errorf("type should be string or array of string")
+			}
+		}
+	default:
+		return fmt.Errorf("type should be string or array of string")
+	}
+
+	if p.Pattern != "" {
+		if p.pattern, err = regexp.Compile(p.Pattern); err != nil {
+			return
+		}
+	}
+
+	p.allowAdditional = true
+
+	if len(p.AdditionalProperties) > 0 {
+		var allow bool
+		if e := json.Unmarshal(p.AdditionalProperties, &allow); e == nil {
+			p.allowAdditional = allow
+		} else {
+			p.additionalProperties = &JsonSchema{}
+			if err = json.Unmarshal(p.AdditionalProperties, p.additionalProperties); err != nil {
+				return
+			}
+			if err = p.additionalProperties.compile(); err != nil {
+				return
+			}
+		}
+	}
+
+	for name, property := range p.Properties {
+		if property == nil {
+			return fmt.Errorf("schema of property %s should be object", name)
+		}
+
+		if err = property.compile(); err != nil {
+			return
+		}
+	}
+
+	if p.Items != nil {
+		if err = p.Items.compile(); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Validate returns the failing fields of data, the data is normalized to
+// json values first, so the data from query string or form could be validated
+func (p *JsonSchema) Validate(data interface{}) (fields []SchemaFieldError, err error) {
+	var b []byte
+	if b, err = json.Marshal(data); err != nil {
+		return
+	}
+
+	var v interface{}
+	if err = json.Unmarshal(b, &v); err != nil {
+		return
+	}
+
+	p.validate("$", v, &fields)
+
+	return
+}
+
+func (p *JsonSchema) validate(path string, v interface{}, fields *[]SchemaFieldError) {
+	addError := func(format string, args ...interface{}) {
+		*fields = append(*fields, SchemaFieldError{Field: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(p.types) > 0 && !matchSchemaTypes(p.types, v) {
+		addError("should be %s", strings.Join(p.types, " or "))
+		return
+	}
+
+	if len(p.Enum) > 0 {
+		matched := false
+		for _, e := range p.Enum {
+			if reflect.DeepEqual(e, v) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			addError("should be one of the enum values")
+		}
+	}
+
+	switch value := v.(type) {
+	case float64:
+		if p.Minimum != nil && (value < *p.Minimum || p.ExclusiveMinimum && value == *p.Minimum) {
+			addError("should not be less than %v", *p.Minimum)
+		}
+
+		if p.Maximum != nil && (value > *p.Maximum || p.ExclusiveMaximum && value == *p.Maximum) {
+			addError("should not be greater than %v", *p.Maximum)
+		}
+	case string:
+		length := utf8.RuneCountInString(value)
+
+		if p.MinLength != nil && length < *p.MinLength {
+			addError("length should not be less than %d", *p.MinLength)
+		}
+
+		if p.MaxLength != nil && length > *p.MaxLength {
+			addError("length should not be greater than %d", *p.MaxLength)
+		}
+
+		if p.pattern != nil && !p.pattern.MatchString(value) {
+			addError("should match pattern %s", p.Pattern)
+		}
+	case []interface{}:
+		if p.MinItems != nil && len(value) < *p.MinItems {
+			addError("items should not be less than %d", *p.MinItems)
+		}
+
+		if p.MaxItems != nil && len(value) > *p.MaxItems {
+			addError("items should not be more than %d", *p.MaxItems)
+		}
+
+		if p.Items != nil {
+			for i, item := range value {
+				p.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, fields)
+			}
+		}
+	case map[string]interface{}:
+		for _, key := range p.Required {
+			if _, exist := value[key]; !exist {
+				*fields = append(*fields, SchemaFieldError{Field: path + "." + key, Message: "is required"})
+			}
+		}
+
+		keys := []string{}
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if property, exist := p.Properties[key]; exist {
+				property.validate(path+"."+key, value[key], fields)
+			} else if p.additionalProperties != nil {
+				p.additionalProperties.validate(path+"."+key, value[key], fields)
+			} else if !p.allowAdditional {
+				*fields = append(*fields, SchemaFieldError{Field: path + "." + key, Message: "is not allowed"})
+			}
+		}
+	}
+}
+
+func matchSchemaTypes(types []string, v interface{}) bool {
+	for _, t := range types {
+		switch t {
+		case "null":
+			if v == nil {
+				return true
+			}
+		case "boolean":
+			if _, ok := v.(bool); ok {
+				return true
+			}
+		case "string":
+			if _, ok := v.(string); ok {
+				return true
+			}
+		case "number":
+			if _, ok := v.(float64); ok {
+				return true
+			}
+		case "integer":
+			if f, ok := v.(float64); ok && f == math.Trunc(f) {
+				return true
+			}
+		case "array":
+			if _, ok := v.([]interface{}); ok {
+				return true
+			}
+		case "object":
+			if _, ok := v.(map[string]interface{}); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func newSchemaValidationError(apiName string, fields []SchemaFieldError) *SchemaValidationError {
+	strFields := []string{}
+	for _, field := range fields {
+		strFields = append(strFields, field.Field+" "+field.Message)
+	}
+
+	return &SchemaValidationError{
+		ErrCode: ErrApiDataValidateFailed.New(errors.Params{"apiName": apiName, "fields": strings.Join(strFields, "; ")}),
+		Fields:  fields,
+	}
+}
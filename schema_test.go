@@ -0,0 +1,86 @@
+package http_json_api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJsonSchemaValidate(t *testing.T) {
+	schema, err := NewJsonSchema(map[string]interface{}{
+		"type":                 "object",
+		"required":             []string{"id"},
+		"additionalProperties": false,
+		"properties": map[string]interface{}{
+			"id":     map[string]interface{}{"type": "integer", "minimum": 1},
+			"name":   map[string]interface{}{"type": "string", "minLength": 1, "maxLength": 4, "pattern": "^[a-z]+$"},
+			"status": map[string]interface{}{"enum": []interface{}{"open", "closed"}},
+			"tags": map[string]interface{}{
+				"type":     "array",
+				"maxItems": 2,
+				"items":    map[string]interface{}{"type": "string"},
+			},
+			"extra": map[string]interface{}{
+				"type":                 []interface{}{"object", "null"},
+				"additionalProperties": map[string]interface{}{"type": "number"},
+			},
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name         string
+		data         interface{}
+		expectFields []string
+	}{
+		{"valid", map[string]interface{}{"id": 1, "name": "abc", "status": "open", "tags": []string{"a"}, "extra": nil}, nil},
+		{"not object", []int{1}, []string{"$"}},
+		{"required", map[string]interface{}{}, []string{"$.id"}},
+		{"not integer", map[string]interface{}{"id": 1.5}, []string{"$.id"}},
+		{"less than minimum", map[string]interface{}{"id": 0}, []string{"$.id"}},
+		{"too long and not match", map[string]interface{}{"id": 1, "name": "ABCDE"}, []string{"$.name", "$.name"}},
+		{"not in enum", map[string]interface{}{"id": 1, "status": "draft"}, []string{"$.status"}},
+		{"too many items", map[string]interface{}{"id": 1, "tags": []interface{}{"a", "b", 3}}, []string{"$.tags", "$.tags[2]"}},
+		{"additional property schema", map[string]interface{}{"id": 1, "extra": map[string]interface{}{"a": 1, "b": "x"}}, []string{"$.extra.b"}},
+		{"additional property not allowed", map[string]interface{}{"id": 1, "other": 1}, []string{"$.other"}},
+	}
+
+	for _, c := range cases {
+		fields, err := schema.Validate(c.data)
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+
+		var fieldNames []string
+		for _, field := range fields {
+			fieldNames = append(fieldNames, field.Field)
+		}
+
+		if !reflect.DeepEqual(fieldNames, c.expectFields) {
+			t.Errorf("%s: expect failing fields %v, got %v", c.name, c.expectFields, fields)
+		}
+	}
+}
+
+func TestNewJsonSchemaInvalid(t *testing.T) {
+	cases := []struct {
+		name   string
+		schema interface{}
+	}{
+		{"bad type", map[string]interface{}{"type": 1}},
+		{"bad type of array", map[string]interface{}{"type": []interface{}{"string", 1}}},
+		{"bad pattern", map[string]interface{}{"pattern": "("}},
+		{"null property", map[string]interface{}{"properties": map[string]interface{}{"a": nil}}},
+		{"bad property", map[string]interface{}{"properties": map[string]interface{}{"id": map[string]interface{}{"type": true}}}},
+		{"file not exist", "/not/exist/schema.json"},
+	}
+
+	for _, c := range cases {
+		if _, err := NewJsonSchema(c.schema); err == nil {
+			t.Errorf("%s: expect error", c.name)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package http_json_api
+
+import (
+	gohttp "net/http"
+)
+
+var (
+	DefaultErrorStatusCode            = gohttp.StatusInternalServerError
+	DefaultMultiCallPartialStatusCode = gohttp.StatusMultiStatus
+)
+
+var internalStatusCodes = map[uint64]int{
+	100: gohttp.StatusInternalServerError,
+	400: gohttp.StatusInternalServerError,
+	401: gohttp.StatusInternalServerError,
+	402: gohttp.StatusInternalServerError,
+	403: gohttp.StatusInternalServerError,
+	404: gohttp.StatusInternalServerError,
+	405: gohttp.StatusInternalServerError,
+	406: gohttp.StatusMethodNotAllowed,
+	407: gohttp.StatusBadRequest,
+	408: gohttp.StatusRequestTimeout,
+	409: gohttp.StatusRequestEntityTooLarge,
+	410: gohttp.StatusBadRequest,
+	411: gohttp.StatusBadRequest,
+	412: gohttp.StatusBadRequest,
+	413: gohttp.StatusInternalServerError,
+	414: gohttp.StatusBadRequest,
+	415: gohttp.StatusBadRequest,
+	416: gohttp.StatusBadRequest,
+	417: gohttp.StatusFailedDependency,
+	418: gohttp.StatusFailedDependency,
+	419: gohttp.StatusUnauthorized,
+	420: gohttp.StatusUnauthorized,
+	421: gohttp.StatusUnauthorized,
+	422: gohttp.StatusUnauthorized,
+	423: gohttp.StatusInternalServerError,
+	424: gohttp.StatusTooManyRequests,
+	425: gohttp.StatusInternalServerError,
+	426: gohttp.StatusUnprocessableEntity,
+	427: gohttp.StatusConflict,
+	428: gohttp.StatusInternalServerError,
+	429: gohttp.StatusInternalServerError,
+	430: gohttp.StatusInternalServerError,
+	431: gohttp.StatusRequestEntityTooLarge,
+	500: gohttp.StatusInternalServerError,
+	501: gohttp.StatusBadRequest,
+	502: gohttp.StatusInternalServerError,
+}
+
+type StatusCodeConfig struct {
+	AlwaysOK         bool                      `json:"always_ok"`
+	DefaultError     int                       `json:"default_error"`
+	MultiCallPartial int                       `json:"multi_call_partial"`
+	Namespaces       map[string]int            `json:"namespaces"`
+	Codes            map[string]map[uint64]int `json:"codes"`
+}
+
+func (p *StatusCodeConfig) initial() {
+	if p.DefaultError == 0 {
+		p.DefaultError = DefaultErrorStatusCode
+	}
+
+	if p.MultiCallPartial == 0 {
+		p.MultiCallPartial = DefaultMultiCallPartialStatusCode
+	}
+
+	if p.Codes == nil {
+		p.Codes = make(map[string]map[uint64]int)
+	}
+
+	codes := p.Codes[HttpJsonApiErrNamespace]
+	if codes == nil {
+		codes = make(map[uint64]int)
+		p.Codes[HttpJsonApiErrNamespace] = codes
+	}
+
+	for code, statusCode := range internalStatusCodes {
+		if _, exist := codes[code]; !exist {
+			codes[code] = statusCode
+		}
+	}
+}
+
+// StatusCode resolves the http status code of an api response, per-code
+// overrides first, then the namespace, then the default error status
+func (p *StatusCodeConfig) StatusCode(resp APIResponse) int {
+	if p.AlwaysOK || resp.Code == 0 {
+		return gohttp.StatusOK
+	}
+
+	if codes, exist := p.Codes[resp.ErrorNamespace]; exist {
+		if statusCode, exist := codes[resp.Code]; exist {
+			return statusCode
+		}
+	}
+
+	if statusCode, exist := p.Namespaces[resp.ErrorNamespace]; exist {
+		return statusCode
+	}
+
+	return p.DefaultError
+}
+
+// MultiCallStatusCode is 200 when every call succeeded, the shared status
+// code when every call failed the same way, otherwise the partial status
+func (p *StatusCodeConfig) MultiCallStatusCode(responses map[string]APIResponse) int {
+	if p.AlwaysOK {
+		return gohttp.StatusOK
+	}
+
+	failed := 0
+	failedStatusCode := 0
+
+	for _, resp := range responses {
+		if resp.Code == 0 {
+			continue
+		}
+
+		statusCode := p.StatusCode(resp)
+
+		if failed == 0 {
+			failedStatusCode = statusCode
+		} else if failedStatusCode != statusCode {
+			failedStatusCode = 0
+		}
+
+		failed++
+	}
+
+	if failed == 0 {
+		return gohttp.StatusOK
+	}
+
+	if failed == len(responses) && failedStatusCode != 0 {
+		return failedStatusCode
+	}
+
+	return p.MultiCallPartial
+}
@@ -0,0 +1,84 @@
+package http_json_api
+
+import (
+	gohttp "net/http"
+	"testing"
+)
+
+func TestStatusCode(t *testing.T) {
+	newConf := func(conf StatusCodeConfig) StatusCodeConfig {
+		conf.initial()
+		return conf
+	}
+
+	defaultConf := newConf(StatusCodeConfig{})
+
+	overrideConf := newConf(StatusCodeConfig{
+		DefaultError: gohttp.StatusBadGateway,
+		Namespaces:   map[string]int{"ORDER": gohttp.StatusBadRequest},
+		Codes: map[string]map[uint64]int{
+			"ORDER":                 {1002: gohttp.StatusNotFound},
+			HttpJsonApiErrNamespace: {408: gohttp.StatusGatewayTimeout},
+		},
+	})
+
+	alwaysOKConf := newConf(StatusCodeConfig{AlwaysOK: true})
+
+	timeout := APIResponse{Code: 408, ErrorNamespace: HttpJsonApiErrNamespace}
+	generic := APIResponse{Code: 500, ErrorNamespace: HttpJsonApiErrNamespace}
+
+	cases := []struct {
+		name   string
+		conf   StatusCodeConfig
+		resp   APIResponse
+		expect int
+	}{
+		{"succeeded", defaultConf, APIResponse{}, gohttp.StatusOK},
+		{"built-in timeout", defaultConf, timeout, gohttp.StatusRequestTimeout},
+		{"built-in generic", defaultConf, generic, gohttp.StatusInternalServerError},
+		{"default error", defaultConf, APIResponse{Code: 1001, ErrorNamespace: "ORDER"}, DefaultErrorStatusCode},
+		{"namespace override", overrideConf, APIResponse{Code: 1001, ErrorNamespace: "ORDER"}, gohttp.StatusBadRequest},
+		{"code override", overrideConf, APIResponse{Code: 1002, ErrorNamespace: "ORDER"}, gohttp.StatusNotFound},
+		{"built-in code override", overrideConf, timeout, gohttp.StatusGatewayTimeout},
+		{"built-in code kept", overrideConf, generic, gohttp.StatusInternalServerError},
+		{"configured default error", overrideConf, APIResponse{Code: 1001, ErrorNamespace: "USER"}, gohttp.StatusBadGateway},
+		{"always ok", alwaysOKConf, timeout, gohttp.StatusOK},
+	}
+
+	for _, c := range cases {
+		if statusCode := c.conf.StatusCode(c.resp); statusCode != c.expect {
+			t.Errorf("%s: expect status %d, got %d", c.name, c.expect, statusCode)
+		}
+	}
+}
+
+func TestMultiCallStatusCode(t *testing.T) {
+	conf := StatusCodeConfig{Namespaces: map[string]int{"ORDER": gohttp.StatusBadRequest}}
+	conf.initial()
+
+	alwaysOKConf := StatusCodeConfig{AlwaysOK: true}
+	alwaysOKConf.initial()
+
+	ok := APIResponse{}
+	orderErr := APIResponse{Code: 1001, ErrorNamespace: "ORDER"}
+	timeout := APIResponse{Code: 408, ErrorNamespace: HttpJsonApiErrNamespace}
+
+	cases := []struct {
+		name      string
+		conf      StatusCodeConfig
+		responses map[string]APIResponse
+		expect    int
+	}{
+		{"all ok", conf, map[string]APIResponse{"a": ok, "b": ok}, gohttp.StatusOK},
+		{"partial", conf, map[string]APIResponse{"a": ok, "b": orderErr}, gohttp.StatusMultiStatus},
+		{"all fail the same way", conf, map[string]APIResponse{"a": orderErr, "b": orderErr}, gohttp.StatusBadRequest},
+		{"all fail differently", conf, map[string]APIResponse{"a": orderErr, "b": timeout}, gohttp.StatusMultiStatus},
+		{"always ok", alwaysOKConf, map[string]APIResponse{"a": ok, "b": orderErr}, gohttp.StatusOK},
+	}
+
+	for _, c := range cases {
+		if statusCode := c.conf.MultiCallStatusCode(c.responses); statusCode != c.expect {
+			t.Errorf("%s: expect status %d, got %d", c.name, c.expect, statusCode)
+		}
+	}
+}
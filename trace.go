@@ -0,0 +1,339 @@
+package http_json_api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	gohttp "net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogap/errors"
+	"github.com/gogap/spirit"
+)
+
+const (
+	HeaderTraceparent = "traceparent"
+	HeaderTracestate  = "tracestate"
+
+	SpanExporterStdout = "stdout"
+
+	SpanRequest  = "request"
+	SpanDispatch = "dispatch"
+	SpanRender   = "render"
+)
+
+// TraceConfig propagates the w3c trace context through the deliveries, the
+// spans of request, delivery dispatch and render are exported by the exporter
+type TraceConfig struct {
+	Enabled bool `json:"enabled"`
+
+	Exporter        string     `json:"exporter"`
+	ExporterOptions spirit.Map `json:"exporter_options"`
+}
+
+func (p *TraceConfig) initial() {
+	if p.Exporter == "" {
+		p.Exporter = SpanExporterStdout
+	}
+}
+
+// TraceContext is the w3c trace context, the span id is the parent of the
+// spans in downstream
+type TraceContext struct {
+	TraceId    string `json:"trace_id"`
+	SpanId     string `json:"span_id"`
+	TraceFlags string `json:"trace_flags"`
+	TraceState string `json:"trace_state"`
+}
+
+// ParseTraceContext parses the traceparent header as
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func ParseTraceContext(traceparent, tracestate string) (trace TraceContext, ok bool) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return
+	}
+
+	// the future versions may append fields
+	if parts[0] == "00" && len(parts) != 4 {
+		return
+	}
+
+	if !isTraceHex(parts[1], 32) || !isTraceHex(parts[2], 16) || !isTraceHex(parts[3], 2) {
+		return
+	}
+
+	// the all zero ids are invalid
+	if strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return
+	}
+
+	trace = TraceContext{
+		TraceId:    parts[1],
+		SpanId:     parts[2],
+		TraceFlags: parts[3],
+		TraceState: strings.TrimSpace(tracestate),
+	}
+
+	return trace, true
+}
+
+func (p TraceContext) Traceparent() string {
+	return "00-" + p.TraceId + "-" + p.SpanId + "-" + p.TraceFlags
+}
+
+// toMap returns the trace context stored in delivery metadata and payload
+// context, the traceparent is used as the parent by downstream api clients
+func (p TraceContext) toMap(parentSpanId string) map[string]interface{} {
+	return map[string]interface{}{
+		"trace_id":       p.TraceId,
+		"span_id":        p.SpanId,
+		"parent_span_id": parentSpanId,
+		"traceparent":    p.Traceparent(),
+		"tracestate":     p.TraceState,
+	}
+}
+
+func (p TraceContext) child() TraceContext {
+	p.SpanId = newTraceId(8)
+	return p
+}
+
+func isTraceHex(v string, size int) bool {
+	if len(v) != size {
+		return false
+	}
+
+	for _, c := range v {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newTraceId(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+type Span struct {
+	Name         string                 `json:"name"`
+	TraceId      string                 `json:"trace_id"`
+	SpanId       string                 `json:"span_id"`
+	ParentSpanId string                 `json:"parent_span_id,omitempty"`
+	StartAt      time.Time              `json:"start_at"`
+	EndAt        time.Time              `json:"end_at"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+}
+
+func (p *Span) SetAttribute(key string, value interface{}) {
+	if p == nil {
+		return
+	}
+
+	if p.Attributes == nil {
+		p.Attributes = make(map[string]interface{})
+	}
+
+	p.Attributes[key] = value
+}
+
+type SpanExporter interface {
+	Export(span *Span) (err error)
+}
+
+type NewSpanExporterFunc func(options spirit.Map) (exporter SpanExporter, err error)
+
+var spanExporters = map[string]NewSpanExporterFunc{
+	SpanExporterStdout: func(options spirit.Map) (SpanExporter, error) {
+		return NewStdoutSpanExporter(), nil
+	},
+}
+
+// RegisterSpanExporter registers the exporter could be used in trace config
+func RegisterSpanExporter(name string, fn NewSpanExporterFunc) {
+	spanExporters[name] = fn
+}
+
+// tracer is nil if the trace is disabled, the methods of nil tracer do
+// nothing
+type tracer struct {
+	exporter SpanExporter
+}
+
+func newTracer(conf TraceConfig) (t *tracer, err error) {
+	if !conf.Enabled {
+		return
+	}
+
+	fn, exist := spanExporters[conf.Exporter]
+	if !exist {
+		err = ErrLoadSpanExporterFailed.New(errors.Params{"exporter": conf.Exporter, "err": "exporter not exist"})
+		return
+	}
+
+	options := conf.ExporterOptions
+	if options == nil {
+		options = spirit.Map{}
+	}
+
+	var exporter SpanExporter
+	if exporter, err = fn(options); err != nil {
+		err = ErrLoadSpanExporterFailed.New(errors.Params{"exporter": conf.Exporter, "err": err})
+		return
+	}
+
+	t = &tracer{exporter: exporter}
+
+	return
+}
+
+// StartRequestSpan starts the span of request as the child of the incoming
+// trace context, the traceparent header of request is replaced by the span,
+// so the deliveries and internal multi call layers are its children
+func (p *tracer) StartRequestSpan(req *gohttp.Request) (span *Span) {
+	if p == nil {
+		return
+	}
+
+	parent, ok := ParseTraceContext(req.Header.Get(HeaderTraceparent), req.Header.Get(HeaderTracestate))
+	if !ok {
+		parent = TraceContext{TraceId: newTraceId(16), TraceFlags: "01"}
+	}
+
+	trace := parent.child()
+
+	span = &Span{
+		Name:         SpanRequest,
+		TraceId:      trace.TraceId,
+		SpanId:       trace.SpanId,
+		ParentSpanId: parent.SpanId,
+		StartAt:      time.Now(),
+	}
+
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.path", req.URL.Path)
+
+	req.Header.Set(HeaderTraceparent, trace.Traceparent())
+
+	return
+}
+
+// StartSpan starts the span as the child of the trace context of request
+func (p *tracer) StartSpan(name string, req *gohttp.Request) (span *Span) {
+	if p == nil {
+		return
+	}
+
+	parent, ok := ParseTraceContext(req.Header.Get(HeaderTraceparent), req.Header.Get(HeaderTracestate))
+	if !ok {
+		return
+	}
+
+	return p.startSpan(name, parent, parent.child())
+}
+
+// StartDeliverySpans starts the dispatch spans of the deliveries, the key of
+// spans is the delivery id
+func (p *tracer) StartDeliverySpans(deliveries []spirit.Delivery, req *gohttp.Request) (spans map[string]*Span) {
+	if p == nil {
+		return
+	}
+
+	parent, ok := ParseTraceContext(req.Header.Get(HeaderTraceparent), req.Header.Get(HeaderTracestate))
+	if !ok {
+		return
+	}
+
+	spans = map[string]*Span{}
+
+	for _, delivery := range deliveries {
+		jsonApiDelivery, ok := delivery.(*HttpJsonApiDelivery)
+		if !ok || jsonApiDelivery.trace.SpanId == "" {
+			continue
+		}
+
+		span := p.startSpan(SpanDispatch, parent, jsonApiDelivery.trace)
+		span.SetAttribute("api", jsonApiDelivery.apiName)
+		span.SetAttribute("delivery_id", jsonApiDelivery.id)
+		span.SetAttribute("urn", jsonApiDelivery.urn)
+
+		spans[delivery.Id()] = span
+	}
+
+	return
+}
+
+func (p *tracer) startSpan(name string, parent, trace TraceContext) *Span {
+	return &Span{
+		Name:         name,
+		TraceId:      trace.TraceId,
+		SpanId:       trace.SpanId,
+		ParentSpanId: parent.SpanId,
+		StartAt:      time.Now(),
+	}
+}
+
+func (p *tracer) EndSpan(span *Span, resp *APIResponse) {
+	if p == nil || span == nil {
+		return
+	}
+
+	span.EndAt = time.Now()
+
+	if resp != nil {
+		span.SetAttribute("code", resp.Code)
+		if resp.Code != 0 {
+			span.SetAttribute("error_namespace", resp.ErrorNamespace)
+			span.SetAttribute("error_id", resp.ErrorId)
+		}
+	}
+
+	if err := p.exporter.Export(span); err != nil {
+		spirit.Logger().
+			WithField("event", "export span").
+			WithField("trace_id", span.TraceId).
+			WithField("span_id", span.SpanId).
+			Errorln(err)
+	}
+}
+
+// deliveryTraceContext returns the trace context of delivery as the child of
+// the request span
+func (p *tracer) deliveryTraceContext(req *gohttp.Request) (trace TraceContext, parentSpanId string, ok bool) {
+	if p == nil {
+		return
+	}
+
+	var parent TraceContext
+	if parent, ok = ParseTraceContext(req.Header.Get(HeaderTraceparent), req.Header.Get(HeaderTracestate)); !ok {
+		return
+	}
+
+	return parent.child(), parent.SpanId, true
+}
+
+// StdoutSpanExporter writes the spans to stdout as json lines
+type StdoutSpanExporter struct {
+	encoder *json.Encoder
+	locker  sync.Mutex
+}
+
+func NewStdoutSpanExporter() *StdoutSpanExporter {
+	return &StdoutSpanExporter{
+		encoder: json.NewEncoder(os.Stdout),
+	}
+}
+
+func (p *StdoutSpanExporter) Export(span *Span) (err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	return p.encoder.Encode(span)
+}
@@ -0,0 +1,122 @@
+package http_json_api
+
+import (
+	gohttp "net/http"
+	"sync"
+	"testing"
+
+	"github.com/gogap/spirit"
+)
+
+type testSpanExporter struct {
+	spans  []*Span
+	locker sync.Mutex
+}
+
+func (p *testSpanExporter) Export(span *Span) (err error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.spans = append(p.spans, span)
+	return
+}
+
+func TestParseTraceContext(t *testing.T) {
+	cases := []struct {
+		traceparent string
+		expectOk    bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{" 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00 ", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", false},
+		{"", false},
+	}
+
+	for _, c := range cases {
+		trace, ok := ParseTraceContext(c.traceparent, "k=v")
+		if ok != c.expectOk {
+			t.Errorf("%q: expect ok %v, got %v", c.traceparent, c.expectOk, ok)
+			continue
+		}
+
+		if ok && (trace.TraceId != "4bf92f3577b34da6a3ce929d0e0e4736" || trace.SpanId != "00f067aa0ba902b7" || trace.TraceState != "k=v") {
+			t.Errorf("%q: unexpected trace context %v", c.traceparent, trace)
+		}
+	}
+}
+
+func TestNewTracer(t *testing.T) {
+	if tracer, err := newTracer(TraceConfig{Enabled: false}); err != nil || tracer != nil {
+		t.Errorf("expect nil tracer if disabled, got %v %v", tracer, err)
+	}
+
+	if _, err := newTracer(TraceConfig{Enabled: true, Exporter: "not_exist"}); err == nil {
+		t.Errorf("expect error of unknown exporter")
+	}
+
+	var nilTracer *tracer
+	req, _ := gohttp.NewRequest("POST", "/order.get", nil)
+	if span := nilTracer.StartRequestSpan(req); span != nil {
+		t.Errorf("expect no span of nil tracer, got %v", span)
+	}
+	nilTracer.EndSpan(nil, nil)
+}
+
+func TestTracerExportSpans(t *testing.T) {
+	exporter := &testSpanExporter{}
+
+	RegisterSpanExporter("test", func(options spirit.Map) (SpanExporter, error) {
+		return exporter, nil
+	})
+
+	tracer, err := newTracer(TraceConfig{Enabled: true, Exporter: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := gohttp.NewRequest("POST", "/order.get", nil)
+	req.Header.Set(HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	requestSpan := tracer.StartRequestSpan(req)
+
+	if requestSpan.TraceId != "4bf92f3577b34da6a3ce929d0e0e4736" || requestSpan.ParentSpanId != "00f067aa0ba902b7" {
+		t.Fatalf("expect the request span is child of incoming trace, got %v", requestSpan)
+	}
+
+	// the deliveries are children of the request span
+	trace, parentSpanId, ok := tracer.deliveryTraceContext(req)
+	if !ok || parentSpanId != requestSpan.SpanId || trace.TraceId != requestSpan.TraceId {
+		t.Fatalf("expect the delivery trace is child of request span, got %v %s", trace, parentSpanId)
+	}
+
+	deliveries := []spirit.Delivery{&HttpJsonApiDelivery{id: "d1", apiName: "order.get", trace: trace}}
+
+	spans := tracer.StartDeliverySpans(deliveries, req)
+
+	tracer.EndSpan(spans["d1"], &APIResponse{Code: 1001, ErrorNamespace: "ORDER", ErrorId: "e1"})
+	tracer.EndSpan(requestSpan, nil)
+
+	if len(exporter.spans) != 2 {
+		t.Fatalf("expect 2 spans exported, got %d", len(exporter.spans))
+	}
+
+	dispatchSpan := exporter.spans[0]
+
+	if dispatchSpan.Name != SpanDispatch || dispatchSpan.SpanId != trace.SpanId || dispatchSpan.ParentSpanId != requestSpan.SpanId {
+		t.Errorf("unexpected dispatch span %v", dispatchSpan)
+	}
+
+	if dispatchSpan.Attributes["code"] != uint64(1001) || dispatchSpan.Attributes["error_namespace"] != "ORDER" {
+		t.Errorf("expect the response recorded in span, got %v", dispatchSpan.Attributes)
+	}
+
+	if exporter.spans[1].Name != SpanRequest || exporter.spans[1].EndAt.IsZero() {
+		t.Errorf("unexpected request span %v", exporter.spans[1])
+	}
+}
@@ -1,9 +1,92 @@
 package http_json_api
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
+
+	goerrors "github.com/gogap/errors"
+)
+
+var (
+	errBodyTooLarge = errors.New("body too large")
+
+	jsonNumberRegexp = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
 )
 
+type limitedReader struct {
+	reader   io.Reader
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+func newLimitedReader(reader io.Reader, limit int64) *limitedReader {
+	return &limitedReader{reader: reader, limit: limit}
+}
+
+func (p *limitedReader) Read(b []byte) (n int, err error) {
+	if p.exceeded {
+		return 0, errBodyTooLarge
+	}
+
+	n, err = p.reader.Read(b)
+	p.read += int64(n)
+
+	if p.limit > 0 && p.read > p.limit {
+		p.exceeded = true
+		return n, errBodyTooLarge
+	}
+
+	return
+}
+
+func (p *limitedReader) Exceeded() bool {
+	return p.exceeded
+}
+
+func isSwitchOn(v string) bool {
+	return v == "1" || v == "on" || v == "true"
+}
+
+func notifyDone(done chan<- bool) {
+	// notify the main handler finished
+	select {
+	case done <- true:
+		{
+		}
+	case <-time.After(time.Second * 3):
+		{
+		}
+	}
+}
+
+// watchDone calls fn once the request handled, the done returned should be
+// notified instead of the origin. the request failed before handling is
+// notified with false, the origin is not notified as the main handler does
+// not wait for it
+func watchDone(done chan<- bool, fn func()) chan<- bool {
+	watched := make(chan bool, 1)
+
+	go func() {
+		handled := <-watched
+
+		fn()
+
+		if handled {
+			notifyDone(done)
+		}
+	}()
+
+	return watched
+}
+
 func parseRefer(url string) (protocol string, domain string) {
 	url = strings.TrimSpace(url)
 
@@ -21,3 +104,122 @@ func parseRefer(url string) (protocol string, domain string) {
 
 	return
 }
+
+// queryToData converts query values to api data, the values of repeated keys
+// or keys end with "[]" become arrays, numbers and booleans are coerced
+func queryToData(values url.Values) (data map[string]interface{}) {
+	data = make(map[string]interface{})
+
+	for key, vals := range values {
+		isArray := len(vals) > 1
+
+		if strings.HasSuffix(key, "[]") {
+			key = strings.TrimSuffix(key, "[]")
+			isArray = true
+		}
+
+		if key == "" {
+			continue
+		}
+
+		if !isArray {
+			data[key] = coerceQueryValue(vals[0])
+			continue
+		}
+
+		arr := []interface{}{}
+		for _, v := range vals {
+			arr = append(arr, coerceQueryValue(v))
+		}
+		data[key] = arr
+	}
+
+	return
+}
+
+// coerceQueryValue only coerces the values in json number syntax, the
+// values like "007", "NaN" or the integers overflow int64 are kept as strings
+func coerceQueryValue(v string) interface{} {
+	if v == "true" || v == "false" {
+		return v == "true"
+	}
+
+	if !jsonNumberRegexp.MatchString(v) {
+		return v
+	}
+
+	if !strings.ContainsAny(v, ".eE") {
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i
+		}
+		return v
+	}
+
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f
+	}
+
+	return v
+}
+
+// decodeJsonBody decodes the json body, the null body is rejected as it
+// leaves the data nil
+func decodeJsonBody(body []byte, v interface{}) (err error) {
+	if trimmed := bytes.TrimSpace(body); bytes.Equal(trimmed, []byte("null")) {
+		err = ErrMalformedJsonBody.New(goerrors.Params{"offset": 0}).Append("body should not be null")
+		return
+	}
+
+	if err = json.Unmarshal(body, v); err == nil {
+		return
+	}
+
+	offset := int64(-1)
+
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	}
+
+	err = ErrMalformedJsonBody.New(goerrors.Params{"offset": offset}).Append(err)
+
+	return
+}
+
+// isApiResponseSucceeded is true if every call of the response succeeded, the
+// empty response is not succeeded
+func isApiResponseSucceeded(apiResponse map[string]APIResponse) bool {
+	if len(apiResponse) == 0 {
+		return false
+	}
+
+	for _, resp := range apiResponse {
+		if resp.Code != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isApiResponseFinal is false if the response is empty or any call timed out
+// or failed internally, the call with business error is final
+func isApiResponseFinal(apiResponse map[string]APIResponse) bool {
+	if len(apiResponse) == 0 {
+		return false
+	}
+
+	for _, resp := range apiResponse {
+		if resp.ErrorNamespace != HttpJsonApiErrNamespace {
+			continue
+		}
+
+		if resp.Code == ErrRequestTimeout.New().Code() || resp.Code == ErrApiGenericError.New().Code() {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,40 @@
+package http_json_api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCoerceQueryValue(t *testing.T) {
+	cases := []struct {
+		value  string
+		expect interface{}
+	}{
+		{"true", true},
+		{"false", false},
+		{"0", int64(0)},
+		{"42", int64(42)},
+		{"-42", int64(-42)},
+		{"1.5", 1.5},
+		{"-1e3", -1000.0},
+		{"007", "007"},
+		{"-01", "-01"},
+		{"1.", "1."},
+		{".5", ".5"},
+		{"+1", "+1"},
+		{"0x10", "0x10"},
+		{"NaN", "NaN"},
+		{"Inf", "Inf"},
+		{"-infinity", "-infinity"},
+		{"1e400", "1e400"},
+		{"92233720368547758070", "92233720368547758070"},
+		{"", ""},
+		{"abc", "abc"},
+	}
+
+	for _, c := range cases {
+		if v := coerceQueryValue(c.value); !reflect.DeepEqual(v, c.expect) {
+			t.Errorf("coerceQueryValue(%q) = %#v, expect %#v", c.value, v, c.expect)
+		}
+	}
+}